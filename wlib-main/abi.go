@@ -0,0 +1,662 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/xerrors"
+)
+
+// Solidity contract ABI encoding, see
+// https://docs.soliditylang.org/en/latest/abi-spec.html
+
+const abiWordSize = 32
+
+type abiKind int
+
+const (
+	abiUint abiKind = iota
+	abiInt
+	abiAddress
+	abiBool
+	abiFixedBytes
+	abiBytes
+	abiString
+	abiSlice
+	abiArray
+	abiTuple
+)
+
+type abiType struct {
+	kind   abiKind
+	size   int // bits for ints, length for fixed bytes and fixed arrays
+	elem   *abiType
+	fields []*abiType
+}
+
+func (t *abiType) String() string {
+	switch t.kind {
+	case abiUint:
+		return fmt.Sprintf("uint%d", t.size)
+	case abiInt:
+		return fmt.Sprintf("int%d", t.size)
+	case abiAddress:
+		return "address"
+	case abiBool:
+		return "bool"
+	case abiFixedBytes:
+		return fmt.Sprintf("bytes%d", t.size)
+	case abiBytes:
+		return "bytes"
+	case abiString:
+		return "string"
+	case abiSlice:
+		return t.elem.String() + "[]"
+	case abiArray:
+		return fmt.Sprintf("%s[%d]", t.elem, t.size)
+	default:
+		names := make([]string, len(t.fields))
+		for i, f := range t.fields {
+			names[i] = f.String()
+		}
+		return "(" + strings.Join(names, ",") + ")"
+	}
+}
+
+func (t *abiType) dynamic() bool {
+	switch t.kind {
+	case abiBytes, abiString, abiSlice:
+		return true
+	case abiArray:
+		return t.elem.dynamic()
+	case abiTuple:
+		for _, f := range t.fields {
+			if f.dynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// abiMaxStaticSize bounds the head size of static arrays so that nested
+// lengths cannot overflow headSize.
+const abiMaxStaticSize = 1 << 24
+
+// headSize is the number of bytes the type takes in the head of its enclosing tuple.
+func (t *abiType) headSize() int {
+	if t.dynamic() {
+		return abiWordSize
+	}
+
+	switch t.kind {
+	case abiArray:
+		return t.size * t.elem.headSize()
+	case abiTuple:
+		n := 0
+		for _, f := range t.fields {
+			n += f.headSize()
+		}
+		return n
+	default:
+		return abiWordSize
+	}
+}
+
+// splitABIList splits "a,(b,c),d" at top-level commas.
+func splitABIList(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, xerrors.Errorf("unbalanced parentheses in %q", s)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, xerrors.Errorf("unbalanced parentheses in %q", s)
+	}
+
+	return append(parts, strings.TrimSpace(s[start:])), nil
+}
+
+func parseABIType(s string) (*abiType, error) {
+	s = strings.TrimSpace(s)
+	// drop parameter names such as "address to"
+	if !strings.HasSuffix(s, ")") && !strings.HasSuffix(s, "]") {
+		if i := strings.LastIndexByte(s, ' '); i > 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+	}
+
+	if strings.HasSuffix(s, "]") {
+		i := strings.LastIndexByte(s, '[')
+		if i < 0 {
+			return nil, xerrors.Errorf("invalid abi type %q", s)
+		}
+		elem, err := parseABIType(s[:i])
+		if err != nil {
+			return nil, err
+		}
+		if s[i+1:len(s)-1] == "" {
+			return &abiType{kind: abiSlice, elem: elem}, nil
+		}
+		n, err := strconv.Atoi(s[i+1 : len(s)-1])
+		if err != nil || n <= 0 {
+			return nil, xerrors.Errorf("invalid array length in %q", s)
+		}
+		if n > abiMaxStaticSize/elem.headSize() {
+			return nil, xerrors.Errorf("array %q is too large", s)
+		}
+		return &abiType{kind: abiArray, size: n, elem: elem}, nil
+	}
+
+	if strings.HasPrefix(s, "(") {
+		if !strings.HasSuffix(s, ")") {
+			return nil, xerrors.Errorf("invalid tuple type %q", s)
+		}
+		fields, err := parseABITypes(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			return nil, xerrors.Errorf("empty tuple type %q", s)
+		}
+		return &abiType{kind: abiTuple, fields: fields}, nil
+	}
+
+	switch {
+	case s == "address":
+		return &abiType{kind: abiAddress}, nil
+	case s == "bool":
+		return &abiType{kind: abiBool}, nil
+	case s == "string":
+		return &abiType{kind: abiString}, nil
+	case s == "bytes":
+		return &abiType{kind: abiBytes}, nil
+	case s == "byte":
+		return &abiType{kind: abiFixedBytes, size: 1}, nil
+	case strings.HasPrefix(s, "bytes"):
+		n, err := strconv.Atoi(s[len("bytes"):])
+		if err != nil || n < 1 || n > 32 {
+			return nil, xerrors.Errorf("invalid abi type %q", s)
+		}
+		return &abiType{kind: abiFixedBytes, size: n}, nil
+	case strings.HasPrefix(s, "uint"), strings.HasPrefix(s, "int"):
+		kind, bits := abiUint, s[len("uint"):]
+		if strings.HasPrefix(s, "int") {
+			kind, bits = abiInt, s[len("int"):]
+		}
+		if bits == "" {
+			return &abiType{kind: kind, size: 256}, nil
+		}
+		n, err := strconv.Atoi(bits)
+		if err != nil || n < 8 || n > 256 || n%8 != 0 {
+			return nil, xerrors.Errorf("invalid abi type %q", s)
+		}
+		return &abiType{kind: kind, size: n}, nil
+	}
+
+	return nil, xerrors.Errorf("unsupported abi type %q", s)
+}
+
+func parseABITypes(s string) ([]*abiType, error) {
+	parts, err := splitABIList(s)
+	if err != nil {
+		return nil, err
+	}
+
+	types := make([]*abiType, 0, len(parts))
+	for _, p := range parts {
+		t, err := parseABIType(p)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+
+	return types, nil
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// parseABISignature parses "transfer(address,uint256)" and returns the 4-byte
+// selector of its canonical form together with the argument types.
+func parseABISignature(sig string) ([]byte, []*abiType, error) {
+	sig = strings.TrimSpace(sig)
+	i := strings.IndexByte(sig, '(')
+	if i <= 0 || !strings.HasSuffix(sig, ")") {
+		return nil, nil, xerrors.Errorf("invalid function signature %q", sig)
+	}
+
+	types, err := parseABITypes(sig[i+1 : len(sig)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canonical := (&abiType{kind: abiTuple, fields: types}).String()
+	selector := keccak256([]byte(strings.TrimSpace(sig[:i]) + canonical))[:4]
+	return selector, types, nil
+}
+
+var (
+	bigOne      = big.NewInt(1)
+	twoTo256    = new(big.Int).Lsh(bigOne, 256)
+	abiTrueWord = append(make([]byte, abiWordSize-1), 1)
+)
+
+func abiPadLeft(b []byte) []byte {
+	if len(b) >= abiWordSize {
+		return b
+	}
+	return append(make([]byte, abiWordSize-len(b)), b...)
+}
+
+func abiPadRight(b []byte) []byte {
+	if len(b)%abiWordSize == 0 {
+		return b
+	}
+	return append(b, make([]byte, abiWordSize-len(b)%abiWordSize)...)
+}
+
+func abiWord(n int) []byte {
+	return abiPadLeft(new(big.Int).SetInt64(int64(n)).Bytes())
+}
+
+func abiBigInt(v interface{}) (*big.Int, error) {
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return nil, xerrors.Errorf("expected a number, got %T", v)
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	body := strings.TrimPrefix(s, "-")
+	base := 10
+	if strings.HasPrefix(body, "0x") || strings.HasPrefix(body, "0X") {
+		body, base = body[2:], 16
+	}
+
+	n, ok := new(big.Int).SetString(body, base)
+	if !ok {
+		return nil, xerrors.Errorf("invalid integer %q", s)
+	}
+	if neg {
+		n.Neg(n)
+	}
+
+	return n, nil
+}
+
+func abiBytesArg(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, xerrors.Errorf("expected a 0x hex string, got %T", v)
+	}
+	return decodeHex(s)
+}
+
+func abiEncode(t *abiType, v interface{}) ([]byte, error) {
+	switch t.kind {
+	case abiUint, abiInt:
+		n, err := abiBigInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == abiUint {
+			if n.Sign() < 0 || n.BitLen() > t.size {
+				return nil, xerrors.Errorf("%s out of range for %s", n, t)
+			}
+			return abiPadLeft(n.Bytes()), nil
+		}
+		limit := new(big.Int).Lsh(bigOne, uint(t.size-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return nil, xerrors.Errorf("%s out of range for %s", n, t)
+		}
+		if n.Sign() < 0 {
+			n = new(big.Int).Add(n, twoTo256)
+		}
+		return abiPadLeft(n.Bytes()), nil
+
+	case abiAddress:
+		s, ok := v.(string)
+		if !ok {
+			return nil, xerrors.Errorf("expected an address string, got %T", v)
+		}
+		a, err := parseEthOrFilAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		eth, err := ethAddressFromFil(a)
+		if err != nil {
+			return nil, err
+		}
+		return abiPadLeft(eth), nil
+
+	case abiBool:
+		var b bool
+		switch v := v.(type) {
+		case bool:
+			b = v
+		case string:
+			var err error
+			if b, err = strconv.ParseBool(v); err != nil {
+				return nil, xerrors.Errorf("invalid bool %q", v)
+			}
+		default:
+			return nil, xerrors.Errorf("expected a bool, got %T", v)
+		}
+		if b {
+			return abiTrueWord, nil
+		}
+		return make([]byte, abiWordSize), nil
+
+	case abiFixedBytes:
+		b, err := abiBytesArg(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > t.size {
+			return nil, xerrors.Errorf("%d bytes do not fit in %s", len(b), t)
+		}
+		return abiPadRight(append([]byte{}, b...)), nil
+
+	case abiBytes, abiString:
+		var b []byte
+		if t.kind == abiString {
+			s, ok := v.(string)
+			if !ok {
+				return nil, xerrors.Errorf("expected a string, got %T", v)
+			}
+			b = []byte(s)
+		} else {
+			var err error
+			if b, err = abiBytesArg(v); err != nil {
+				return nil, err
+			}
+		}
+		return append(abiWord(len(b)), abiPadRight(append([]byte{}, b...))...), nil
+
+	case abiSlice, abiArray:
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, xerrors.Errorf("expected an array for %s, got %T", t, v)
+		}
+		if t.kind == abiArray && len(items) != t.size {
+			return nil, xerrors.Errorf("expected %d items for %s, got %d", t.size, t, len(items))
+		}
+		types := make([]*abiType, len(items))
+		for i := range types {
+			types[i] = t.elem
+		}
+		enc, err := abiEncodeTuple(types, items)
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == abiSlice {
+			enc = append(abiWord(len(items)), enc...)
+		}
+		return enc, nil
+
+	default:
+		items, ok := v.([]interface{})
+		if !ok {
+			return nil, xerrors.Errorf("expected an array for %s, got %T", t, v)
+		}
+		return abiEncodeTuple(t.fields, items)
+	}
+}
+
+func abiEncodeTuple(types []*abiType, values []interface{}) ([]byte, error) {
+	if len(types) != len(values) {
+		return nil, xerrors.Errorf("expected %d values, got %d", len(types), len(values))
+	}
+
+	headLen := 0
+	for _, t := range types {
+		headLen += t.headSize()
+	}
+
+	var head, tail []byte
+	for i, t := range types {
+		enc, err := abiEncode(t, values[i])
+		if err != nil {
+			return nil, xerrors.Errorf("argument %d (%s): %v", i, t, err)
+		}
+		if t.dynamic() {
+			head = append(head, abiWord(headLen+len(tail))...)
+			tail = append(tail, enc...)
+		} else {
+			head = append(head, enc...)
+		}
+	}
+
+	return append(head, tail...), nil
+}
+
+func abiReadWord(data []byte, off int) ([]byte, error) {
+	if off < 0 || off+abiWordSize > len(data) {
+		return nil, xerrors.Errorf("abi data too short: need %d bytes, have %d", off+abiWordSize, len(data))
+	}
+	return data[off : off+abiWordSize], nil
+}
+
+func abiReadInt(data []byte, off int) (int, error) {
+	w, err := abiReadWord(data, off)
+	if err != nil {
+		return 0, err
+	}
+	n := new(big.Int).SetBytes(w)
+	if !n.IsInt64() || n.Int64() > int64(len(data)) {
+		return 0, xerrors.Errorf("abi offset or length %s out of range", n)
+	}
+	return int(n.Int64()), nil
+}
+
+func abiDecode(t *abiType, data []byte, off int) (interface{}, error) {
+	switch t.kind {
+	case abiUint, abiInt:
+		w, err := abiReadWord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).SetBytes(w)
+		if t.kind == abiInt && w[0]&0x80 != 0 {
+			n.Sub(n, twoTo256)
+		}
+		return n.String(), nil
+
+	case abiAddress:
+		w, err := abiReadWord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + hex.EncodeToString(w[abiWordSize-EthAddressLength:]), nil
+
+	case abiBool:
+		w, err := abiReadWord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		return w[abiWordSize-1] == 1, nil
+
+	case abiFixedBytes:
+		w, err := abiReadWord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + hex.EncodeToString(w[:t.size]), nil
+
+	case abiBytes, abiString:
+		n, err := abiReadInt(data, off)
+		if err != nil {
+			return nil, err
+		}
+		start := off + abiWordSize
+		if start+n > len(data) {
+			return nil, xerrors.Errorf("abi data too short for %s of length %d", t, n)
+		}
+		b := data[start : start+n]
+		if t.kind == abiBytes {
+			return "0x" + hex.EncodeToString(b), nil
+		}
+		if !utf8.Valid(b) {
+			return nil, xerrors.Errorf("abi string is not valid utf-8")
+		}
+		return string(b), nil
+
+	case abiSlice, abiArray:
+		n := t.size
+		if t.kind == abiSlice {
+			var err error
+			if n, err = abiReadInt(data, off); err != nil {
+				return nil, err
+			}
+			off += abiWordSize
+		}
+		// every item takes at least one word of head, check before allocating
+		if off > len(data) || n > (len(data)-off)/abiWordSize {
+			return nil, xerrors.Errorf("abi data too short for %d items of %s", n, t.elem)
+		}
+		types := make([]*abiType, n)
+		for i := range types {
+			types[i] = t.elem
+		}
+		return abiDecodeTuple(types, data[off:])
+
+	default:
+		return abiDecodeTuple(t.fields, data[off:])
+	}
+}
+
+func abiDecodeTuple(types []*abiType, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(types))
+	off := 0
+	for i, t := range types {
+		pos := off
+		if t.dynamic() {
+			var err error
+			if pos, err = abiReadInt(data, off); err != nil {
+				return nil, xerrors.Errorf("value %d (%s): %v", i, t, err)
+			}
+		}
+		v, err := abiDecode(t, data, pos)
+		if err != nil {
+			return nil, xerrors.Errorf("value %d (%s): %v", i, t, err)
+		}
+		values = append(values, v)
+		off += t.headSize()
+	}
+
+	return values, nil
+}
+
+func decodeJSONArgs(args string) ([]interface{}, error) {
+	if strings.TrimSpace(args) == "" {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(args)))
+	dec.UseNumber()
+	var values []interface{}
+	if err := dec.Decode(&values); err != nil {
+		return nil, xerrors.Errorf("args must be a json array: %v", err)
+	}
+
+	return values, nil
+}
+
+// encodeABICall returns selector || abi.encode(args).
+func encodeABICall(signature, args string) ([]byte, error) {
+	selector, types, err := parseABISignature(signature)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := decodeJSONArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := abiEncodeTuple(types, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(selector, enc...), nil
+}
+
+type ABIOut struct {
+	Err    string        `json:"err,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+func abiOut(values []interface{}, err error) string {
+	out := &ABIOut{Values: values}
+	if err != nil {
+		out = &ABIOut{Err: err.Error()}
+	}
+
+	return jsonOut(out)
+}
+
+// ABIEncodeCall 按 Solidity ABI 编码合约调用数据
+// signature 形如 "transfer(address,uint256)"
+// args 为 json 数组，比如 ["0x...", "1000000000000000000"]
+// 整数用十进制或 0x 十六进制字符串，bytes 用 0x 十六进制，地址可用 0x、f0 或 f410
+// 输出 {"param": "..."}，param 为 selector 加参数编码
+func ABIEncodeCall(signature, args string) string {
+	enc, err := encodeABICall(signature, args)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	return genOut(enc, nil)
+}
+
+// ABIDecode 按 types（比如 "uint256,bool"）解码 base64 格式的 ABI 数据
+// 输出 {"values": [...]}，整数为十进制字符串，bytes 和地址为 0x 十六进制
+func ABIDecode(types, data string) string {
+	ts, err := parseABITypes(types)
+	if err != nil {
+		return abiOut(nil, err)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return abiOut(nil, xerrors.Errorf("invalid data: %v", err))
+	}
+
+	return abiOut(abiDecodeTuple(ts, b))
+}
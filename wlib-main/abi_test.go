@@ -0,0 +1,134 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+// vectors from https://docs.soliditylang.org/en/latest/abi-spec.html#examples
+func TestABIEncodeCall(t *testing.T) {
+	cases := []struct {
+		sig, args, want string
+	}{
+		{"baz(uint32,bool)", `[69, true]`, "cdcd77c0" +
+			"0000000000000000000000000000000000000000000000000000000000000045" +
+			"0000000000000000000000000000000000000000000000000000000000000001"},
+		{"sam(bytes,bool,uint256[])", `["0x64617665", true, [1, 2, 3]]`, "a5643bf2" +
+			"0000000000000000000000000000000000000000000000000000000000000060" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"00000000000000000000000000000000000000000000000000000000000000a0" +
+			"0000000000000000000000000000000000000000000000000000000000000004" +
+			"6461766500000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000003" +
+			"0000000000000000000000000000000000000000000000000000000000000001" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000003"},
+		{"f(uint,uint32[],bytes10,bytes)", `["0x123", ["0x456", "0x789"], "0x31323334353637383930", "0x48656c6c6f2c20776f726c6421"]`, "8be65246" +
+			"0000000000000000000000000000000000000000000000000000000000000123" +
+			"0000000000000000000000000000000000000000000000000000000000000080" +
+			"3132333435363738393000000000000000000000000000000000000000000000" +
+			"00000000000000000000000000000000000000000000000000000000000000e0" +
+			"0000000000000000000000000000000000000000000000000000000000000002" +
+			"0000000000000000000000000000000000000000000000000000000000000456" +
+			"0000000000000000000000000000000000000000000000000000000000000789" +
+			"000000000000000000000000000000000000000000000000000000000000000d" +
+			"48656c6c6f2c20776f726c642100000000000000000000000000000000000000"},
+	}
+
+	for _, c := range cases {
+		o := parseOut(t, wlib.ABIEncodeCall(c.sig, c.args))
+		require.Equal(t, "", o.Err, c.sig)
+		require.Equal(t, c.want, hex.EncodeToString(o.Param), c.sig)
+	}
+
+	o := parseOut(t, wlib.ABIEncodeCall("baz(uint8)", `[256]`))
+	require.Contains(t, o.Err, "out of range")
+}
+
+func TestABIDecode(t *testing.T) {
+	o := parseOut(t, wlib.ABIEncodeCall("f(int8,string,address[],(bool,bytes2))",
+		`[-5, "hello", ["0xff00000000000000000000000000000000000064"], [true, "0xbeef"]]`))
+	require.Equal(t, "", o.Err)
+
+	var res wlib.ABIOut
+	data := base64.StdEncoding.EncodeToString(o.Param[4:])
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("int8,string,address[],(bool,bytes2)", data)), &res))
+	require.Equal(t, "", res.Err)
+	require.Equal(t, []interface{}{
+		"-5", "hello",
+		[]interface{}{"0xff00000000000000000000000000000000000064"},
+		[]interface{}{true, "0xbeef"},
+	}, res.Values)
+}
+
+func TestEthAddress(t *testing.T) {
+	require.Equal(t, "0xff000000000000000000000000000000000004d2", wlib.FilAddressToEth("t01234"))
+	require.Equal(t, "t01234", wlib.EthAddressToFil("0xff000000000000000000000000000000000004d2"))
+
+	eth := "0xd4c5fb16488aa48081296299d54b0c648c9333da"
+	f410 := wlib.EthAddressToFil(eth)
+	require.True(t, strings.HasPrefix(f410, "t410f"))
+	require.Equal(t, f410, wlib.AddressFromString(f410))
+	require.Equal(t, eth, wlib.FilAddressToEth(f410))
+
+	a, err := address.NewFromString(f410)
+	require.NoError(t, err)
+	require.Equal(t, f410, fmt.Sprint(a))
+	b, err := json.Marshal(a)
+	require.NoError(t, err)
+	require.Equal(t, `"`+f410+`"`, string(b))
+}
+
+func TestGenInvokeContract(t *testing.T) {
+	out := wlib.GenInvokeContract("t01000", "0xd4c5fb16488aa48081296299d54b0c648c9333da",
+		"transfer(address,uint256)", `["0xff000000000000000000000000000000000004d2", "1000"]`, "")
+
+	var msg wlib.Msg
+	require.NoError(t, json.Unmarshal([]byte(out), &msg))
+	require.Equal(t, uint64(3844450837), msg.Method)
+
+	params, err := base64.StdEncoding.DecodeString(msg.Params)
+	require.NoError(t, err)
+	// cbor byte string header for 68 bytes of calldata, then the transfer selector
+	require.Equal(t, "5844a9059cbb", hex.EncodeToString(params[:6]))
+
+	msg.GasLimit = 1000000
+	msg.GasFeeCap = "100"
+	msg.GasPremium = "100"
+	payload, err := json.Marshal(msg)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(wlib.GenCid(string(payload)), "bafy2bzace"))
+}
+
+func TestABIDecodeLargeArray(t *testing.T) {
+	var res wlib.ABIOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("uint256[1000000000]", "")), &res))
+	require.Contains(t, res.Err, "too large")
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("uint256[100000]", "")), &res))
+	require.Contains(t, res.Err, "abi data too short")
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("uint256[4096][4096]", "")), &res))
+	require.Contains(t, res.Err, "too large")
+
+	// a slice claiming 64 items backed by 64 bytes
+	data := make([]byte, 96)
+	data[31], data[63] = 32, 64
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("uint256[]", base64.StdEncoding.EncodeToString(data))), &res))
+	require.Contains(t, res.Err, "abi data too short")
+}
+
+func TestABIEmptyTuple(t *testing.T) {
+	var res wlib.ABIOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIEncodeCall("f(()[2])", "[[[],[]]]")), &res))
+	require.Contains(t, res.Err, "empty tuple")
+	require.NoError(t, json.Unmarshal([]byte(wlib.ABIDecode("()[2]", "")), &res))
+	require.Contains(t, res.Err, "empty tuple")
+	require.Empty(t, parseOut(t, wlib.ABIEncodeCall("f()", "[]")).Err)
+}
@@ -0,0 +1,276 @@
+package wlib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	crypto "github.com/filecoin-project/go-crypto"
+	"golang.org/x/xerrors"
+)
+
+// BatchItem 是批量处理的一条输入。Message 为 json 对象（wlib 或 lotus 格式）
+// 或 base64 cbor 字符串；Key 为 base64 的 secp256k1 私钥，为空时只计算 cid，
+// 签名时消息的 From 必须是 f1 或 ID 地址
+type BatchItem struct {
+	ID      string          `json:"id,omitempty"`
+	Message json.RawMessage `json:"message"`
+	Key     string          `json:"key,omitempty"`
+}
+
+// BatchResult 与输入一一对应，顺序相同，出错的条目只有 Err
+type BatchResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Err   string `json:"err,omitempty"`
+	Cid   string `json:"cid,omitempty"`
+	// 以下只在签名时输出，Signature 为 base64，SignedCid 是推送后在链上的 cid
+	SigType   int    `json:"sig_type,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	SignedCid string `json:"signed_cid,omitempty"`
+	// Signed 是 cbor 编码的 SignedMessage，json 中为 base64
+	Signed []byte `json:"signed,omitempty"`
+}
+
+func batchMessage(raw json.RawMessage) (*Message, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return parseMsgInput(s)
+	}
+	return parseMsg(string(raw))
+}
+
+// batchKeys 缓存同一批次中私钥的解码和对应的地址，批量提现通常只用少数几个热钱包
+type batchKeys struct {
+	m sync.Map
+}
+
+type batchKey struct {
+	ck   []byte
+	addr address.Address
+	err  error
+}
+
+func (k *batchKeys) get(key string) *batchKey {
+	if v, ok := k.m.Load(key); ok {
+		return v.(*batchKey)
+	}
+
+	bk := &batchKey{}
+	bk.ck, bk.err = base64.StdEncoding.DecodeString(key)
+	if bk.err != nil {
+		bk.err = xerrors.Errorf("invalid private key: %v", bk.err)
+	} else {
+		bk.addr, bk.err = secpAddress(bk.ck)
+	}
+	v, _ := k.m.LoadOrStore(key, bk)
+	return v.(*batchKey)
+}
+
+// secpAddress 无效的私钥会让 PublicKey panic
+func secpAddress(ck []byte) (a address.Address, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = xerrors.Errorf("invalid private key: %v", r)
+		}
+	}()
+	if len(ck) != 32 {
+		return address.Undef, xerrors.Errorf("invalid private key: expect 32 bytes, got %d", len(ck))
+	}
+	return address.NewSecp256k1Address(crypto.PublicKey(ck))
+}
+
+func processBatchItem(i int, it *BatchItem, keys *batchKeys) (r *BatchResult) {
+	r = &BatchResult{Index: i, ID: it.ID}
+	defer func() {
+		if re := recover(); re != nil {
+			r = &BatchResult{Index: i, ID: it.ID, Err: fmt.Sprintf("%v", re)}
+		}
+	}()
+	if err := processItem(it, r, keys); err != nil {
+		*r = BatchResult{Index: i, ID: it.ID, Err: err.Error()}
+	}
+	return r
+}
+
+func processItem(it *BatchItem, r *BatchResult, keys *batchKeys) error {
+	if len(it.Message) == 0 {
+		return xerrors.Errorf("missing message")
+	}
+	m, err := batchMessage(it.Message)
+	if err != nil {
+		return err
+	}
+	c := m.Cid()
+	r.Cid = c.String()
+	if it.Key == "" {
+		return nil
+	}
+
+	bk := keys.get(it.Key)
+	if bk.err != nil {
+		return bk.err
+	}
+	// 发送方是 f1 地址时检查私钥与之对应，避免签出无效的消息。
+	// 发送方是 ID 地址时离线无法知道它对应的 f1 地址，私钥不对时签名在链上无效；
+	// f3、f4 地址不能用 secp256k1 签名
+	switch m.From.Protocol() {
+	case address.SECP256K1:
+		if bk.addr != m.From {
+			return xerrors.Errorf("key does not match from address %s", m.From.String())
+		}
+	case address.ID:
+	default:
+		return xerrors.Errorf("cannot sign for from address %s with a secp256k1 key", m.From.String())
+	}
+	ck := bk.ck
+
+	sig, err := secpSign(ck, c.Bytes())
+	if err != nil {
+		return xerrors.Errorf("failed to sign: %v", err)
+	}
+	sm := &SignedMessage{Message: *m, Signature: *sig}
+	var buf bytes.Buffer
+	if err := sm.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("failed to serialize signed message: %v", err)
+	}
+
+	r.SigType = int(sig.Type)
+	r.Signature = base64.StdEncoding.EncodeToString(sig.Data)
+	r.SignedCid = sm.Cid().String()
+	r.Signed = buf.Bytes()
+	return nil
+}
+
+func batchWorkers(workers int) int {
+	if workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return workers
+}
+
+// ProcessBatch 用 workers 个 goroutine 计算 cid 并签名，<= 0 时使用 CPU 核数。
+// 结果与 items 顺序相同，单条出错不影响其它条目
+func ProcessBatch(items []BatchItem, workers int) []BatchResult {
+	results := make([]BatchResult, len(items))
+	next := make(chan int)
+	keys := &batchKeys{}
+
+	var wg sync.WaitGroup
+	for w := 0; w < batchWorkers(workers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = *processBatchItem(i, &items[i], keys)
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+// StreamBatch 从 r 读取 NDJSON（每行一个 BatchItem），按输入顺序向 w 写出
+// NDJSON 结果。最多同时处理 workers * 2 条，内存占用与输入总量无关
+func StreamBatch(r io.Reader, w io.Writer, workers int) error {
+	workers = batchWorkers(workers)
+
+	// pending 保存按输入顺序排队的结果，容量限制了同时处理的条数
+	pending := make(chan chan *BatchResult, workers*2)
+	sem := make(chan struct{}, workers)
+	keys := &batchKeys{}
+
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		i := 0
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+
+			res := make(chan *BatchResult, 1)
+			pending <- res
+			sem <- struct{}{}
+			go func(i int, line string) {
+				defer func() { <-sem }()
+				var it BatchItem
+				if err := json.Unmarshal([]byte(line), &it); err != nil {
+					res <- &BatchResult{Index: i, Err: xerrors.Errorf("invalid item json: %v", err).Error()}
+					return
+				}
+				res <- processBatchItem(i, &it, keys)
+			}(i, line)
+			i++
+		}
+		readErr <- sc.Err()
+	}()
+
+	enc := json.NewEncoder(w)
+	var writeErr error
+	for res := range pending {
+		r := <-res
+		if writeErr == nil {
+			writeErr = enc.Encode(r)
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return <-readErr
+}
+
+// BatchOut 是 BatchProcess 的输出
+type BatchOut struct {
+	Err     string        `json:"err,omitempty"`
+	Results []BatchResult `json:"results,omitempty"`
+}
+
+// BatchProcess 批量计算 cid 和签名，input 为 BatchItem 的 json 数组或 NDJSON，
+// workers <= 0 时使用 CPU 核数
+// 输入 [{"id": "w1", "message": {...}, "key": "base64"}, {"message": "base64 cbor"}]
+// 输出 {"results": [{"index": 0, "id": "w1", "cid": "bafy...", "sig_type": 1,
+// "signature": "...", "signed_cid": "bafy...", "signed": "base64 cbor"}, {"index": 1, "err": "..."}]}
+func BatchProcess(input string, workers int) string {
+	var items []BatchItem
+	if strings.HasPrefix(strings.TrimSpace(input), "[") {
+		if err := json.Unmarshal([]byte(input), &items); err != nil {
+			return batchOut(nil, xerrors.Errorf("invalid input json: %v", err))
+		}
+	} else {
+		dec := json.NewDecoder(strings.NewReader(input))
+		for dec.More() {
+			var it BatchItem
+			if err := dec.Decode(&it); err != nil {
+				return batchOut(nil, xerrors.Errorf("invalid item %d: %v", len(items), err))
+			}
+			items = append(items, it)
+		}
+	}
+
+	return batchOut(ProcessBatch(items, workers), nil)
+}
+
+func batchOut(results []BatchResult, err error) string {
+	o := &BatchOut{Results: results}
+	if err != nil {
+		o.Err = err.Error()
+	}
+
+	return jsonOut(o)
+}
@@ -0,0 +1,174 @@
+package wlib_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+const batchKey = "67WMRDA2ldmfcQ87DSHCy+ppKs3iSyNjxfBD7dR68Qw="
+
+func batchMsg(t testing.TB, nonce int) string {
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(feeMsg), &m))
+	m["from"] = wlib.GenAddress(wlib.SecpPrivateToPublic(batchKey), "secp")
+	m["nonce"] = nonce
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func batchInput(t testing.TB, n int) []wlib.BatchItem {
+	items := make([]wlib.BatchItem, n)
+	for i := range items {
+		items[i] = wlib.BatchItem{ID: fmt.Sprint(i), Message: json.RawMessage(batchMsg(t, i)), Key: batchKey}
+	}
+	return items
+}
+
+func TestProcessBatch(t *testing.T) {
+	items := batchInput(t, 20)
+	items[3].Key = base64.StdEncoding.EncodeToString(make([]byte, 32))
+	items[5].Message = json.RawMessage(`{"to": "bad"}`)
+	items[7].Key = ""
+	items[9].Key = "p7ZGtfT3MyOdkVaEaE2LzT12fcl2N95jsiYuvBZZ1NA="
+
+	results := wlib.ProcessBatch(items, 4)
+	require.Len(t, results, 20)
+	for i, r := range results {
+		require.Equal(t, i, r.Index)
+		require.Equal(t, fmt.Sprint(i), r.ID)
+		switch i {
+		case 3:
+			require.Contains(t, r.Err, "invalid private key")
+		case 9:
+			require.Contains(t, r.Err, "key does not match")
+		case 5:
+			require.Contains(t, r.Err, "invalid to address")
+		case 7:
+			require.Empty(t, r.Err)
+			require.Empty(t, r.Signature)
+			require.Equal(t, wlib.GenCid(batchMsg(t, 7)), r.Cid)
+		default:
+			require.Empty(t, r.Err)
+			require.Equal(t, wlib.GenCid(batchMsg(t, i)), r.Cid)
+			cidBytes := wlib.MessageCid(batchMsg(t, i))
+			require.Equal(t, wlib.SecpSign(batchKey, cidBytes), r.Signature)
+
+			var sm wlib.SignedMessage
+			require.NoError(t, sm.UnmarshalCBOR(bytes.NewReader(r.Signed)))
+			require.Equal(t, r.SignedCid, sm.Cid().String())
+		}
+	}
+}
+
+func TestProcessBatchSenders(t *testing.T) {
+	bls, err := address.NewBLSAddress(make([]byte, address.BlsPublicKeyBytes))
+	require.NoError(t, err)
+	from := []string{
+		"f01234",
+		bls.String(),
+		wlib.EthAccountAddress(wlib.SecpPrivateToPublic(batchKey)),
+	}
+
+	items := make([]wlib.BatchItem, len(from))
+	for i, f := range from {
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(batchMsg(t, i)), &m))
+		m["from"] = f
+		b, err := json.Marshal(m)
+		require.NoError(t, err)
+		items[i] = wlib.BatchItem{Message: json.RawMessage(b), Key: batchKey}
+	}
+
+	results := wlib.ProcessBatch(items, 1)
+	// an id sender cannot be checked against the key offline, so it is signed
+	require.Empty(t, results[0].Err)
+	require.NotEmpty(t, results[0].Signature)
+	require.Contains(t, results[1].Err, "cannot sign for from address")
+	require.Contains(t, results[2].Err, "cannot sign for from address")
+}
+
+func TestBatchProcessNDJSON(t *testing.T) {
+	var sb strings.Builder
+	for _, it := range batchInput(t, 5) {
+		b, err := json.Marshal(&it)
+		require.NoError(t, err)
+		sb.Write(b)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("not json\n")
+
+	var out wlib.BatchOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.BatchProcess(sb.String(), 0)), &out))
+	require.Contains(t, out.Err, "invalid item 5")
+
+	var buf bytes.Buffer
+	require.NoError(t, wlib.StreamBatch(strings.NewReader(sb.String()), &buf, 2))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	for i, l := range lines {
+		var r wlib.BatchResult
+		require.NoError(t, json.Unmarshal([]byte(l), &r))
+		require.Equal(t, i, r.Index)
+		if i < 5 {
+			require.Empty(t, r.Err)
+			require.NotEmpty(t, r.Signature)
+		} else {
+			require.Contains(t, r.Err, "invalid item json")
+		}
+	}
+}
+
+// BenchmarkSingleCidSign is the baseline: one MessageCid + SecpSign per message.
+func BenchmarkSingleCidSign(b *testing.B) {
+	msgs := make([]string, 256)
+	for i := range msgs {
+		msgs[i] = batchMsg(b, i)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, m := range msgs {
+			wlib.SecpSign(batchKey, wlib.MessageCid(m))
+		}
+	}
+}
+
+func BenchmarkProcessBatch(b *testing.B) {
+	items := batchInput(b, 256)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		wlib.ProcessBatch(items, 0)
+	}
+}
+
+func BenchmarkSingleCid(b *testing.B) {
+	msgs := make([]string, 256)
+	for i := range msgs {
+		msgs[i] = batchMsg(b, i)
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, m := range msgs {
+			wlib.GenCid(m)
+		}
+	}
+}
+
+func BenchmarkProcessBatchCid(b *testing.B) {
+	items := batchInput(b, 256)
+	for i := range items {
+		items[i].Key = ""
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		wlib.ProcessBatch(items, 0)
+	}
+}
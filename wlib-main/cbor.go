@@ -0,0 +1,73 @@
+package wlib
+
+import (
+	"fmt"
+	"io"
+
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Small helpers for the hand written CBOR tuple encodings of actor types
+// that specs-actors v5 does not know about yet.
+
+func cborWriteArrayHeader(w io.Writer, n int) error {
+	return cbg.WriteMajorTypeHeader(w, cbg.MajArray, uint64(n))
+}
+
+func cborWriteUint(w io.Writer, n uint64) error {
+	return cbg.WriteMajorTypeHeader(w, cbg.MajUnsignedInt, n)
+}
+
+func cborWriteInt(w io.Writer, n int64) error {
+	if n >= 0 {
+		return cbg.WriteMajorTypeHeader(w, cbg.MajUnsignedInt, uint64(n))
+	}
+	return cbg.WriteMajorTypeHeader(w, cbg.MajNegativeInt, uint64(-n-1))
+}
+
+func cborWriteBytes(w io.Writer, b []byte) error {
+	if len(b) > cbg.ByteArrayMaxLen {
+		return fmt.Errorf("byte array too long (%d)", len(b))
+	}
+	if err := cbg.WriteMajorTypeHeader(w, cbg.MajByteString, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func cborReadArrayHeader(br io.Reader) (int, error) {
+	maj, extra, err := cbg.CborReadHeader(br)
+	if err != nil {
+		return 0, err
+	}
+	if maj != cbg.MajArray {
+		return 0, fmt.Errorf("cbor input should be of type array")
+	}
+	if extra > cbg.MaxLength {
+		return 0, fmt.Errorf("array too large (%d)", extra)
+	}
+	return int(extra), nil
+}
+
+func cborReadTuple(br io.Reader, fields int) error {
+	n, err := cborReadArrayHeader(br)
+	if err != nil {
+		return err
+	}
+	if n != fields {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+	return nil
+}
+
+func cborReadUint(br io.Reader) (uint64, error) {
+	maj, extra, err := cbg.CborReadHeader(br)
+	if err != nil {
+		return 0, err
+	}
+	if maj != cbg.MajUnsignedInt {
+		return 0, fmt.Errorf("wrong type for uint64 field")
+	}
+	return extra, nil
+}
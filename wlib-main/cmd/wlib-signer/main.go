@@ -0,0 +1,91 @@
+// wlib-signer 是远程签名服务，lotus 节点通过
+//
+//	[Wallet]
+//	RemoteBackend = "<token>:http://127.0.0.1:1777/rpc/v0"
+//
+// 使用它签名。只支持 secp256k1 地址（f1），bls 地址（f3）不能创建、导入或签名。
+// keystore 口令从环境变量 WLIB_KEYSTORE_PASSPHRASE 读取，
+// token 文件每行为 "<token> <read|write|sign|admin>"，-policy 指定签名规则（见 signer.Policy），
+// 当天的花费保存在 keystore 目录下的 policy.spent
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib/signer"
+)
+
+func loadTokens(path string) (map[string]signer.Perm, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := map[string]signer.Perm{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		perm := signer.PermSign
+		if len(fields) > 1 {
+			perm = signer.Perm(fields[1])
+		}
+		tokens[fields[0]] = perm
+	}
+	return tokens, sc.Err()
+}
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:1777", "address to listen on")
+	keystore := flag.String("keystore", "./keystore", "keystore directory")
+	tokensPath := flag.String("tokens", "./tokens", "file with one \"<token> <perm>\" per line")
+	accessLog := flag.String("access-log", "-", "access log file, - for stderr")
+	policy := flag.String("policy", "", "signing policy file (.json or .yaml)")
+	flag.Parse()
+
+	ks, err := signer.OpenKeystore(*keystore, os.Getenv("WLIB_KEYSTORE_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("failed to open keystore: %v", err)
+	}
+
+	tokens, err := loadTokens(*tokensPath)
+	if err != nil {
+		log.Fatalf("failed to load tokens: %v", err)
+	}
+
+	var out io.Writer = os.Stderr
+	if *accessLog != "-" {
+		f, err := os.OpenFile(*accessLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("failed to open access log: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	srv := signer.NewServer(ks, tokens, out)
+	if *policy != "" {
+		if srv.Policy, err = signer.LoadPolicyEngine(*policy); err != nil {
+			log.Fatalf("failed to load policy: %v", err)
+		}
+		if err := srv.Policy.PersistSpend(filepath.Join(*keystore, "policy.spent")); err != nil {
+			log.Fatalf("failed to load policy spend: %v", err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/rpc/v0", srv)
+
+	log.Printf("wlib-signer listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
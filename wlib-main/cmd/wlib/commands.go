@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/filecoin-project/go-address"
+	gocrypto "github.com/filecoin-project/go-crypto"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"golang.org/x/xerrors"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func init() {
+	register(
+		&command{name: "key new", usage: "generate a secp256k1 key",
+			run: keyNew},
+		&command{name: "key derive", usage: "derive public key and addresses from -private-key (base64)",
+			flags: []string{"private-key"}, stdin: "private-key", run: keyDerive},
+
+		&command{name: "address from-pubkey", usage: "address of -pubkey (base64), -type secp or bls",
+			flags: []string{"pubkey", "type"}, run: addressFromPubkey},
+		&command{name: "address parse", usage: "normalize -address, also converts 0x addresses",
+			flags: []string{"address"}, run: addressParse},
+
+		&command{name: "message build", usage: "build a message from flags, -value with unit",
+			flags: []string{"from", "to", "value", "nonce", "gas-limit", "gas-fee-cap", "gas-premium", "method", "params"},
+			run:   messageBuild},
+		&command{name: "message cid", usage: "cid of -message (json or base64 cbor)",
+			flags: []string{"message"}, stdin: "message", run: messageCid},
+		&command{name: "message sign", usage: "sign -message from its f1 sender with the matching secp256k1 -private-key (base64)",
+			flags: []string{"message", "private-key"}, stdin: "message", run: messageSign},
+		&command{name: "message decode", usage: "decode -message (base64 cbor, signed or not) to lotus json",
+			flags: []string{"message"}, stdin: "message", run: messageDecode},
+
+		&command{name: "msig create", usage: "constructor params from -input json {signers, threshold, unlock_duration}",
+			flags: []string{"input"}, stdin: "input", run: wrap1(wlib.GenConstructorParamV3, "input")},
+		&command{name: "msig propose-send", usage: "propose sending -value (with unit) -to",
+			flags: []string{"to", "value"}, run: withValue(wrap2(wlib.GenProposeForSendParamV3, "to", "value"))},
+		&command{name: "msig approve", usage: "approve params from -input transaction json",
+			flags: []string{"input"}, stdin: "input", run: wrap1(wlib.GenApprovalV3, "input")},
+
+		&command{name: "miner create", usage: "propose creating a miner with -owner -worker -seal-type",
+			flags: []string{"owner", "worker", "seal-type"}, run: wrap3(wlib.GenCreateMiner, "owner", "worker", "seal-type")},
+		&command{name: "miner withdraw", usage: "propose withdrawing -value (with unit) from -miner",
+			flags: []string{"miner", "value"}, run: withValue(wrap2(wlib.GenProposalForWithdrawBalanceV3, "miner", "value"))},
+		&command{name: "miner change-worker", usage: "propose changing the worker of -miner, -input json",
+			flags: []string{"miner", "input"}, stdin: "input", run: wrap2(wlib.GenProposalForChangeWorkerAddress, "miner", "input")},
+		&command{name: "miner confirm-worker", usage: "propose confirming the worker change of -miner",
+			flags: []string{"miner"}, run: wrap1(wlib.GenConfirmUpdateWorkerKey, "miner")},
+		&command{name: "miner change-owner", usage: "propose changing the owner of -miner to -new-owner, -value (with unit)",
+			flags: []string{"new-owner", "miner", "value"}, run: withValue(wrap3(wlib.GenProposalForChangeOwnerV3, "new-owner", "miner", "value"))},
+
+		&command{name: "verifreg add-verifier", usage: "propose adding -verifier with -allowance",
+			flags: []string{"verifier", "allowance"}, run: wrap2(wlib.GenProposalForAddVerifier, "verifier", "allowance")},
+		&command{name: "verifreg remove-verifier", usage: "propose removing -verifier",
+			flags: []string{"verifier"}, run: wrap1(wlib.GenProposalForRemoveVerifier, "verifier")},
+		&command{name: "verifreg add-client", usage: "propose adding -client with -allowance",
+			flags: []string{"client", "allowance"}, run: wrap2(wlib.GenProposalForAddVerifiedClient, "client", "allowance")},
+
+		&command{name: "fil", usage: "convert -amount (\"1.5 FIL\", \"100 afil\") between units",
+			flags: []string{"amount"}, run: filConvert},
+
+		&command{name: "params decode", usage: "decode base64 -params, -kind proposal|datacap-balance|datacap-transfer|eam-create|abi",
+			flags: []string{"params", "kind", "types"}, stdin: "params", run: paramsDecode},
+	)
+}
+
+func wrap1(fn func(string) string, a1 string) func(args) (interface{}, error) {
+	return func(a args) (interface{}, error) {
+		return fn(a[a1]), nil
+	}
+}
+
+func wrap2(fn func(string, string) string, a1, a2 string) func(args) (interface{}, error) {
+	return func(a args) (interface{}, error) {
+		return fn(a[a1], a[a2]), nil
+	}
+}
+
+func wrap3(fn func(string, string, string) string, a1, a2, a3 string) func(args) (interface{}, error) {
+	return func(a args) (interface{}, error) {
+		return fn(a[a1], a[a2], a[a3]), nil
+	}
+}
+
+// parseValue 解析 -value，必须带单位，如 "1.5 FIL"、"1000 aFIL"
+func parseValue(s string) (abi.TokenAmount, error) {
+	s = strings.TrimSpace(s)
+	if r, _ := utf8.DecodeLastRuneInString(s); !unicode.IsLetter(r) {
+		return abi.TokenAmount{}, xerrors.Errorf("invalid value(%s): a unit is required, e.g. \"1.5 FIL\" or \"1000 aFIL\"", s)
+	}
+	v, err := wlib.ParseFIL(s)
+	if err != nil {
+		return abi.TokenAmount{}, xerrors.Errorf("invalid value(%s): %v", s, err)
+	}
+	return abi.TokenAmount(v), nil
+}
+
+// withValue 把 -value 转换为 attoFIL 后调用 run
+func withValue(run func(args) (interface{}, error)) func(args) (interface{}, error) {
+	return func(a args) (interface{}, error) {
+		v, err := parseValue(a["value"])
+		if err != nil {
+			return nil, err
+		}
+		b := args{}
+		for k, s := range a {
+			b[k] = s
+		}
+		b["value"] = v.String()
+		return run(b)
+	}
+}
+
+type keyOut struct {
+	PrivateKey string `json:"private_key,omitempty"`
+	PublicKey  string `json:"public_key"`
+	Address    string `json:"address"`
+	EthAddress string `json:"eth_address"`
+}
+
+func deriveKey(pk []byte) *keyOut {
+	pub := base64.StdEncoding.EncodeToString(gocrypto.PublicKey(pk))
+	return &keyOut{
+		PublicKey:  pub,
+		Address:    wlib.GenAddress(pub, "secp"),
+		EthAddress: wlib.EthAccountAddress(pub),
+	}
+}
+
+func keyNew(args) (interface{}, error) {
+	pk, err := gocrypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	out := deriveKey(pk)
+	out.PrivateKey = base64.StdEncoding.EncodeToString(pk)
+	return out, nil
+}
+
+func keyDerive(a args) (interface{}, error) {
+	pk, err := base64.StdEncoding.DecodeString(a["private-key"])
+	if err != nil || len(pk) != 32 {
+		return nil, xerrors.Errorf("invalid private key, expect 32 bytes in base64")
+	}
+	return deriveKey(pk), nil
+}
+
+type addressOut struct {
+	Address    string `json:"address"`
+	EthAddress string `json:"eth_address,omitempty"`
+}
+
+func addressFromPubkey(a args) (interface{}, error) {
+	t := a["type"]
+	if t == "" {
+		t = "secp"
+	}
+	if t != "secp" && t != "bls" {
+		return nil, xerrors.Errorf("invalid type %q, expect secp or bls", t)
+	}
+	addr := wlib.GenAddress(a["pubkey"], t)
+	if addr == "" {
+		return nil, xerrors.Errorf("invalid %s public key", t)
+	}
+	return &addressOut{Address: wlib.AddressFromString(addr)}, nil
+}
+
+func addressParse(a args) (interface{}, error) {
+	addr, err := address.NewFromString(a["address"])
+	if err != nil {
+		return nil, xerrors.Errorf("invalid address(%s): %v", a["address"], err)
+	}
+	s := addr.String()
+	return &addressOut{Address: s, EthAddress: wlib.FilAddressToEth(s)}, nil
+}
+
+// parseMessage 接受 lotus 或 wlib 格式的 json，以及 base64 cbor
+func parseMessage(s string) (*wlib.Message, error) {
+	if s == "" {
+		return nil, xerrors.Errorf("missing -message")
+	}
+	if json.Valid([]byte(s)) {
+		var m wlib.Message
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			return nil, xerrors.Errorf("invalid message json: %v", err)
+		}
+		return &m, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("message is neither json nor base64 cbor: %v", err)
+	}
+	var m wlib.Message
+	if err := m.UnmarshalCBOR(bytes.NewReader(b)); err == nil {
+		return &m, nil
+	}
+	var sm wlib.SignedMessage
+	if err := sm.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, xerrors.Errorf("failed to decode cbor message: %v", err)
+	}
+	return &sm.Message, nil
+}
+
+func messageBuild(a args) (interface{}, error) {
+	var m wlib.Message
+	var err error
+	if m.From, err = address.NewFromString(a["from"]); err != nil {
+		return nil, xerrors.Errorf("invalid from address(%s): %v", a["from"], err)
+	}
+	if m.To, err = address.NewFromString(a["to"]); err != nil {
+		return nil, xerrors.Errorf("invalid to address(%s): %v", a["to"], err)
+	}
+
+	m.Value = wlib.NewInt(0)
+	if a["value"] != "" {
+		if m.Value, err = parseValue(a["value"]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		v    *uint64
+	}{{"nonce", &m.Nonce}, {"method", (*uint64)(&m.Method)}} {
+		if a[f.name] == "" {
+			continue
+		}
+		if *f.v, err = strconv.ParseUint(a[f.name], 10, 64); err != nil {
+			return nil, xerrors.Errorf("invalid %s(%s): %v", f.name, a[f.name], err)
+		}
+	}
+	if a["gas-limit"] != "" {
+		if m.GasLimit, err = strconv.ParseInt(a["gas-limit"], 10, 64); err != nil {
+			return nil, xerrors.Errorf("invalid gas-limit(%s): %v", a["gas-limit"], err)
+		}
+	}
+
+	m.GasFeeCap, m.GasPremium = wlib.NewInt(0), wlib.NewInt(0)
+	for _, f := range []struct {
+		name string
+		v    *abi.TokenAmount
+	}{{"gas-fee-cap", &m.GasFeeCap}, {"gas-premium", &m.GasPremium}} {
+		if a[f.name] == "" {
+			continue
+		}
+		if *f.v, err = wlib.BigFromString(a[f.name]); err != nil {
+			return nil, xerrors.Errorf("invalid %s(%s): %v", f.name, a[f.name], err)
+		}
+	}
+
+	if m.Params, err = base64.StdEncoding.DecodeString(a["params"]); err != nil {
+		return nil, xerrors.Errorf("invalid params: %v", err)
+	}
+	return &m, nil
+}
+
+type cidOut struct {
+	Cid   string `json:"cid"`
+	Bytes []byte `json:"bytes"`
+}
+
+func messageCid(a args) (interface{}, error) {
+	m, err := parseMessage(a["message"])
+	if err != nil {
+		return nil, err
+	}
+	c := m.Cid()
+	return &cidOut{Cid: c.String(), Bytes: c.Bytes()}, nil
+}
+
+func messageSign(a args) (interface{}, error) {
+	m, err := parseMessage(a["message"])
+	if err != nil {
+		return nil, err
+	}
+	if a["private-key"] == "" {
+		return nil, xerrors.Errorf("missing -private-key")
+	}
+	// 只签 f1 发送方，且私钥必须对应它：ID 地址离线无法核对，
+	// f3、f4 地址不能用 secp256k1 签名
+	if m.From.Protocol() != address.SECP256K1 {
+		return nil, xerrors.Errorf("cannot sign for from address %s with a secp256k1 key", m.From.String())
+	}
+	keyAddr, err := address.NewFromString(wlib.GenAddress(wlib.SecpPrivateToPublic(a["private-key"]), "secp"))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid private key")
+	}
+	if keyAddr != m.From {
+		return nil, xerrors.Errorf("key does not match from address %s", m.From.String())
+	}
+
+	sig := wlib.SecpSign(a["private-key"], base64.StdEncoding.EncodeToString(m.Cid().Bytes()))
+	if sig == "" {
+		return nil, xerrors.Errorf("failed to sign, invalid private key")
+	}
+	data, _ := base64.StdEncoding.DecodeString(sig)
+	return &wlib.SignedMessage{Message: *m, Signature: crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: data}}, nil
+}
+
+func messageDecode(a args) (interface{}, error) {
+	b, err := base64.StdEncoding.DecodeString(a["message"])
+	if err != nil {
+		return nil, xerrors.Errorf("invalid base64 message: %v", err)
+	}
+	var sm wlib.SignedMessage
+	if err := sm.UnmarshalCBOR(bytes.NewReader(b)); err == nil {
+		return &sm, nil
+	}
+	var m wlib.Message
+	if err := m.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, xerrors.Errorf("failed to decode cbor message: %v", err)
+	}
+	return &m, nil
+}
+
+type filOut struct {
+	FIL     string `json:"fil"`
+	AttoFIL string `json:"attofil"`
+	Short   string `json:"short"`
+}
+
+func filConvert(a args) (interface{}, error) {
+	f, err := wlib.ParseFIL(a["amount"])
+	if err != nil {
+		return nil, xerrors.Errorf("invalid amount(%s): %v", a["amount"], err)
+	}
+	return &filOut{FIL: f.String(), AttoFIL: f.Int.String(), Short: f.Short()}, nil
+}
+
+func paramsDecode(a args) (interface{}, error) {
+	p := a["params"]
+	switch a["kind"] {
+	case "", "proposal":
+		return wlib.DescribeProposal(p), nil
+	case "datacap-balance":
+		return wlib.DecodeDatacapBalance(p), nil
+	case "datacap-transfer":
+		return wlib.DecodeDatacapTransferReturn(p), nil
+	case "eam-create":
+		return wlib.DecodeCreateReturn(p), nil
+	case "abi":
+		if a["types"] == "" {
+			return nil, xerrors.Errorf("-kind abi needs -types, e.g. \"uint256,bool\"")
+		}
+		return wlib.ABIDecode(a["types"], p), nil
+	default:
+		return nil, xerrors.Errorf("unknown kind %q", a["kind"])
+	}
+}
@@ -0,0 +1,200 @@
+// wlib 是 wlib 的命令行工具，脚本里不需要再写 go 代码调用 GenCid、
+// GenApprovalV3 等函数，例如
+//
+//	wlib message build -from f1... -to f01234 -value "1.5 FIL" -nonce 3 | wlib message cid
+//	wlib msig propose-send -to f1... -value "1000 aFIL"
+//	echo '{"signers":["f1..."],"threshold":1}' | wlib msig create
+//
+// -value 必须带单位（FIL、nFIL、aFIL 等），避免把 FIL 和 attoFIL 弄混。
+// 参数用 flag 传入，JSON 或消息类的参数没有给出时从 stdin 读取，值为 "-" 时
+// 也从 stdin 读取。结果总是一个 JSON 写到 stdout，出错时包含 "err" 字段并以
+// 状态 1 退出
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"golang.org/x/xerrors"
+)
+
+// command 是一个子命令，flags 中的参数都是字符串，stdin 是没有给出时从
+// stdin 读取的参数名
+type command struct {
+	name  string
+	usage string
+	flags []string
+	stdin string
+	run   func(a args) (interface{}, error)
+}
+
+type args map[string]string
+
+var commands = map[string]*command{}
+
+func register(cmds ...*command) {
+	for _, c := range cmds {
+		commands[c.name] = c
+	}
+}
+
+// errOut 与 wlib 的 {"err": "..."} 输出相同
+type errOut struct {
+	Err string `json:"err"`
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: wlib [-network mainnet|testnet] <command> [flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	var names []string
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(w, "  %-28s %s\n", n, commands[n].usage)
+	}
+}
+
+// lookup 支持两级命令，如 "msig approve"
+func lookup(argv []string) (*command, []string) {
+	if len(argv) >= 2 {
+		if c, ok := commands[argv[0]+" "+argv[1]]; ok {
+			return c, argv[2:]
+		}
+	}
+	if len(argv) >= 1 {
+		if c, ok := commands[argv[0]]; ok {
+			return c, argv[1:]
+		}
+	}
+	return nil, nil
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
+
+func (c *command) parse(argv []string, stdin io.Reader, stderr io.Writer) (args, error) {
+	fs := flag.NewFlagSet("wlib "+c.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	vals := map[string]*string{}
+	for _, f := range c.flags {
+		vals[f] = fs.String(f, "", "")
+	}
+	if err := fs.Parse(argv); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, xerrors.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	a := args{}
+	for f, v := range vals {
+		a[f] = *v
+	}
+
+	var from string
+	for f, v := range a {
+		if v == "-" {
+			if from != "" {
+				return nil, xerrors.Errorf("both -%s and -%s read from stdin", from, f)
+			}
+			from = f
+		}
+	}
+	if from == "" && c.stdin != "" && a[c.stdin] == "" && !isTerminal(stdin) {
+		from = c.stdin
+	}
+	if from != "" {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read -%s from stdin: %v", from, err)
+		}
+		a[from] = strings.TrimSpace(string(b))
+	}
+	return a, nil
+}
+
+// write 输出结果，wlib 返回的 JSON 字符串原样输出，其余编码为 JSON。
+// 返回结果中是否有错误
+func write(w io.Writer, res interface{}) bool {
+	var b []byte
+	if s, ok := res.(string); ok && json.Valid([]byte(s)) {
+		b = []byte(s)
+	} else {
+		var err error
+		if b, err = json.Marshal(res); err != nil {
+			b, _ = json.Marshal(&errOut{Err: err.Error()})
+		}
+	}
+
+	var out errOut
+	failed := json.Unmarshal(b, &out) == nil && out.Err != ""
+
+	var buf bytes.Buffer
+	if json.Indent(&buf, b, "", "  ") == nil {
+		b = buf.Bytes()
+	}
+	fmt.Fprintln(w, string(b))
+	return failed
+}
+
+func run(argv []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("wlib", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr) }
+	network := fs.String("network", "mainnet", "address network prefix, mainnet (f) or testnet (t)")
+	if err := fs.Parse(argv); err != nil {
+		return 2
+	}
+
+	switch *network {
+	case "mainnet":
+		address.CurrentNetwork = address.Mainnet
+	case "testnet":
+		address.CurrentNetwork = address.Testnet
+	default:
+		fmt.Fprintf(stderr, "unknown network %q\n", *network)
+		return 2
+	}
+
+	c, rest := lookup(fs.Args())
+	if c == nil {
+		usage(stderr)
+		return 2
+	}
+
+	a, err := c.parse(rest, stdin, stderr)
+	if err == flag.ErrHelp {
+		return 2
+	}
+	if err == nil {
+		var res interface{}
+		if res, err = c.run(a); err == nil {
+			if write(stdout, res) {
+				return 1
+			}
+			return 0
+		}
+	}
+	write(stdout, &errOut{Err: err.Error()})
+	return 1
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func runCLI(t *testing.T, stdin string, argv ...string) (map[string]interface{}, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(argv, strings.NewReader(stdin), &stdout, &stderr)
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out), stdout.String()+stderr.String())
+	return out, code
+}
+
+func TestMessageWorkflow(t *testing.T) {
+	key, code := runCLI(t, "", "key", "new")
+	require.Equal(t, 0, code)
+	require.True(t, strings.HasPrefix(key["address"].(string), "f1"))
+
+	var stdout bytes.Buffer
+	require.Equal(t, 0, run([]string{"message", "build", "-from", key["address"].(string), "-to", "f01234",
+		"-value", "1.5 FIL", "-nonce", "3", "-gas-limit", "1000000", "-gas-fee-cap", "100000"}, nil, &stdout, &stdout))
+	msg := stdout.String()
+
+	c, code := runCLI(t, msg, "message", "cid")
+	require.Equal(t, 0, code)
+
+	signed, code := runCLI(t, msg, "message", "sign", "-private-key", key["private_key"].(string))
+	require.Equal(t, 0, code)
+	require.Equal(t, c["cid"], signed["Message"].(map[string]interface{})["CID"].(map[string]interface{})["/"])
+
+	b, err := json.Marshal(signed)
+	require.NoError(t, err)
+	var sm wlib.SignedMessage
+	require.NoError(t, json.Unmarshal(b, &sm))
+	var buf bytes.Buffer
+	require.NoError(t, sm.MarshalCBOR(&buf))
+
+	decoded, code := runCLI(t, base64.StdEncoding.EncodeToString(buf.Bytes()), "message", "decode")
+	require.Equal(t, 0, code)
+	require.Equal(t, "1500000000000000000", decoded["Message"].(map[string]interface{})["Value"])
+
+	other, code := runCLI(t, "", "key", "new")
+	require.Equal(t, 0, code)
+	out, code := runCLI(t, msg, "message", "sign", "-private-key", other["private_key"].(string))
+	require.Equal(t, 1, code)
+	require.Contains(t, out["err"], "key does not match from address")
+
+	stdout.Reset()
+	require.Equal(t, 0, run([]string{"message", "build", "-from", "f01000", "-to", "f01234",
+		"-value", "1.5 FIL"}, nil, &stdout, &stdout))
+	out, code = runCLI(t, stdout.String(), "message", "sign", "-private-key", key["private_key"].(string))
+	require.Equal(t, 1, code)
+	require.Contains(t, out["err"], "cannot sign for from address")
+}
+
+func TestBuilders(t *testing.T) {
+	out, code := runCLI(t, "", "msig", "propose-send", "-to", "f01234", "-value", "1000 aFIL")
+	require.Equal(t, 0, code)
+	require.Equal(t, "hEMA0glDAAPoAEA=", out["param"])
+
+	// -value is the same unit everywhere and must carry it
+	out, code = runCLI(t, "", "msig", "propose-send", "-to", "f01234", "-value", "1000")
+	require.Equal(t, 1, code)
+	require.Contains(t, out["err"], "unit is required")
+	_, code = runCLI(t, "", "message", "build", "-from", "f01000", "-to", "f01234", "-value", "1.5")
+	require.Equal(t, 1, code)
+
+	out, code = runCLI(t, `{"signers":["f01234"],"threshold":1}`, "msig", "create")
+	require.Equal(t, 0, code)
+	require.NotEmpty(t, out["param"])
+
+	out, code = runCLI(t, "", "fil", "-amount", "1.5")
+	require.Equal(t, 0, code)
+	require.Equal(t, "1500000000000000000", out["attofil"])
+
+	out, code = runCLI(t, "", "-network", "testnet", "address", "parse", "-address", "f01234")
+	require.Equal(t, 0, code)
+	require.Equal(t, "t01234", out["address"])
+
+	out, code = runCLI(t, "", "miner", "withdraw", "-miner", "bad", "-value", "1 FIL")
+	require.Equal(t, 1, code)
+	require.NotEmpty(t, out["err"])
+}
@@ -0,0 +1,462 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	cid "github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// MethodsDatacap are the FRC-46 token methods of the datacap actor (f07).
+var MethodsDatacap = struct {
+	Name              abi.MethodNum
+	Symbol            abi.MethodNum
+	TotalSupply       abi.MethodNum
+	Balance           abi.MethodNum
+	Transfer          abi.MethodNum
+	TransferFrom      abi.MethodNum
+	IncreaseAllowance abi.MethodNum
+	DecreaseAllowance abi.MethodNum
+	RevokeAllowance   abi.MethodNum
+	Burn              abi.MethodNum
+	BurnFrom          abi.MethodNum
+	Allowance         abi.MethodNum
+	Granularity       abi.MethodNum
+}{48890204, 2061153854, 114981429, 3261979605, 80475954, 3621052141, 1777121560, 1529376545, 2765635761, 1434719642, 2979674018, 4205072950, 3936767397}
+
+const DatacapActorID = 7
+
+// DataCap tokens have 18 decimals: one byte of DataCap is 10^18 token units.
+var DatacapTokenPrecision = NewInt(FilecoinPrecision)
+
+// Allocation limits enforced by the verified registry.
+const (
+	MinimumVerifiedAllocationSize = 1 << 20
+	MinimumVerifiedAllocationTerm = abi.ChainEpoch(180 * 2880)
+	MaximumVerifiedAllocationTerm = abi.ChainEpoch(5 * 365 * 2880)
+)
+
+type AllocationRequest struct {
+	Provider   abi.ActorID
+	Data       cid.Cid
+	Size       abi.PaddedPieceSize
+	TermMin    abi.ChainEpoch
+	TermMax    abi.ChainEpoch
+	Expiration abi.ChainEpoch
+}
+
+type ClaimExtensionRequest struct {
+	Provider abi.ActorID
+	Claim    uint64
+	TermMax  abi.ChainEpoch
+}
+
+// AllocationRequests is the operator data of a datacap Transfer to f06.
+type AllocationRequests struct {
+	Allocations []AllocationRequest
+	Extensions  []ClaimExtensionRequest
+}
+
+type DatacapTransferParams struct {
+	To           address.Address
+	Amount       abi.TokenAmount
+	OperatorData []byte
+}
+
+type DatacapTransferReturn struct {
+	FromBalance   abi.TokenAmount
+	ToBalance     abi.TokenAmount
+	RecipientData []byte
+}
+
+type FailCode struct {
+	Idx  uint64
+	Code exitcode.ExitCode
+}
+
+type BatchReturn struct {
+	SuccessCount uint64
+	FailCodes    []FailCode
+}
+
+// AllocationsResponse is the recipient data returned by f06.
+type AllocationsResponse struct {
+	AllocationResults BatchReturn
+	ExtensionResults  BatchReturn
+	NewAllocations    []uint64
+}
+
+func (t *AllocationRequests) MarshalCBOR(w io.Writer) error {
+	if err := cborWriteArrayHeader(w, 2); err != nil {
+		return err
+	}
+
+	if err := cborWriteArrayHeader(w, len(t.Allocations)); err != nil {
+		return err
+	}
+	for _, a := range t.Allocations {
+		if err := cborWriteArrayHeader(w, 6); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, uint64(a.Provider)); err != nil {
+			return err
+		}
+		if err := cbg.WriteCid(w, a.Data); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, uint64(a.Size)); err != nil {
+			return err
+		}
+		for _, e := range []abi.ChainEpoch{a.TermMin, a.TermMax, a.Expiration} {
+			if err := cborWriteInt(w, int64(e)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cborWriteArrayHeader(w, len(t.Extensions)); err != nil {
+		return err
+	}
+	for _, e := range t.Extensions {
+		if err := cborWriteArrayHeader(w, 3); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, uint64(e.Provider)); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, e.Claim); err != nil {
+			return err
+		}
+		if err := cborWriteInt(w, int64(e.TermMax)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *DatacapTransferParams) MarshalCBOR(w io.Writer) error {
+	if err := cborWriteArrayHeader(w, 3); err != nil {
+		return err
+	}
+	if err := t.To.MarshalCBOR(w); err != nil {
+		return err
+	}
+	if err := t.Amount.MarshalCBOR(w); err != nil {
+		return err
+	}
+	return cborWriteBytes(w, t.OperatorData)
+}
+
+func (t *DatacapTransferReturn) UnmarshalCBOR(r io.Reader) error {
+	*t = DatacapTransferReturn{}
+
+	br := cbg.GetPeeker(r)
+	if err := cborReadTuple(br, 3); err != nil {
+		return err
+	}
+	if err := t.FromBalance.UnmarshalCBOR(br); err != nil {
+		return xerrors.Errorf("unmarshaling t.FromBalance: %w", err)
+	}
+	if err := t.ToBalance.UnmarshalCBOR(br); err != nil {
+		return xerrors.Errorf("unmarshaling t.ToBalance: %w", err)
+	}
+
+	var err error
+	t.RecipientData, err = cbg.ReadByteArray(br, cbg.ByteArrayMaxLen)
+	return err
+}
+
+func (t *BatchReturn) UnmarshalCBOR(r io.Reader) error {
+	*t = BatchReturn{}
+
+	br := cbg.GetPeeker(r)
+	if err := cborReadTuple(br, 2); err != nil {
+		return err
+	}
+
+	var err error
+	if t.SuccessCount, err = cborReadUint(br); err != nil {
+		return err
+	}
+
+	n, err := cborReadArrayHeader(br)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := cborReadTuple(br, 2); err != nil {
+			return err
+		}
+		idx, err := cborReadUint(br)
+		if err != nil {
+			return err
+		}
+		code, err := cborReadUint(br)
+		if err != nil {
+			return err
+		}
+		t.FailCodes = append(t.FailCodes, FailCode{Idx: idx, Code: exitcode.ExitCode(code)})
+	}
+	return nil
+}
+
+func (t *AllocationsResponse) UnmarshalCBOR(r io.Reader) error {
+	*t = AllocationsResponse{}
+
+	br := cbg.GetPeeker(r)
+	if err := cborReadTuple(br, 3); err != nil {
+		return err
+	}
+	if err := t.AllocationResults.UnmarshalCBOR(br); err != nil {
+		return xerrors.Errorf("unmarshaling t.AllocationResults: %w", err)
+	}
+	if err := t.ExtensionResults.UnmarshalCBOR(br); err != nil {
+		return xerrors.Errorf("unmarshaling t.ExtensionResults: %w", err)
+	}
+
+	n, err := cborReadArrayHeader(br)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		id, err := cborReadUint(br)
+		if err != nil {
+			return err
+		}
+		t.NewAllocations = append(t.NewAllocations, id)
+	}
+	return nil
+}
+
+func isPowerOfTwo(n uint64) bool {
+	return n != 0 && n&(n-1) == 0
+}
+
+type AllocationRequestInput struct {
+	Provider   string `json:"provider"`
+	Data       string `json:"data"`
+	Size       uint64 `json:"size"`
+	TermMin    int64  `json:"term_min"`
+	TermMax    int64  `json:"term_max"`
+	Expiration int64  `json:"expiration"`
+}
+
+type ClaimExtensionInput struct {
+	Provider string `json:"provider"`
+	ClaimID  uint64 `json:"claim_id"`
+	TermMax  int64  `json:"term_max"`
+	Size     uint64 `json:"size"`
+}
+
+// DatacapTransferInput 分配 DataCap 的 json 格式
+//
+//	{
+//	 "allocations": [{"provider": "f01234", "data": "baga6ea4sea...", "size": 34359738368,
+//	                  "term_min": 518400, "term_max": 5256000, "expiration": 3000000}],
+//	 "extensions": [{"provider": "f01234", "claim_id": 7, "term_max": 5256000, "size": 34359738368}]
+//	}
+//
+// size 为 padded piece 大小（字节），extensions 的 size 为 claim 的大小，只用于计算转账金额
+type DatacapTransferInput struct {
+	Allocations []AllocationRequestInput `json:"allocations"`
+	Extensions  []ClaimExtensionInput    `json:"extensions"`
+}
+
+// Transfer returns the operator data and the DataCap amount it needs.
+func (d *DatacapTransferInput) Transfer() (*AllocationRequests, abi.TokenAmount, error) {
+	reqs := &AllocationRequests{
+		Allocations: []AllocationRequest{},
+		Extensions:  []ClaimExtensionRequest{},
+	}
+	total := NewInt(0)
+
+	for i, a := range d.Allocations {
+		provider, err := parseActorID(a.Provider)
+		if err != nil {
+			return nil, EmptyInt, xerrors.Errorf("allocation %d: invalid provider(%s): %v", i, a.Provider, err)
+		}
+		data, err := cid.Decode(a.Data)
+		if err != nil {
+			return nil, EmptyInt, xerrors.Errorf("allocation %d: invalid piece cid(%s): %v", i, a.Data, err)
+		}
+		if a.Size < MinimumVerifiedAllocationSize || !isPowerOfTwo(a.Size) {
+			return nil, EmptyInt, xerrors.Errorf("allocation %d: size %d must be a power of two of at least %d", i, a.Size, MinimumVerifiedAllocationSize)
+		}
+		termMin, termMax := abi.ChainEpoch(a.TermMin), abi.ChainEpoch(a.TermMax)
+		if termMin < MinimumVerifiedAllocationTerm || termMax > MaximumVerifiedAllocationTerm || termMin > termMax {
+			return nil, EmptyInt, xerrors.Errorf("allocation %d: terms must satisfy %d <= term_min(%d) <= term_max(%d) <= %d",
+				i, MinimumVerifiedAllocationTerm, termMin, termMax, MaximumVerifiedAllocationTerm)
+		}
+
+		reqs.Allocations = append(reqs.Allocations, AllocationRequest{
+			Provider:   provider,
+			Data:       data,
+			Size:       abi.PaddedPieceSize(a.Size),
+			TermMin:    termMin,
+			TermMax:    termMax,
+			Expiration: abi.ChainEpoch(a.Expiration),
+		})
+		total = BigAdd(total, NewInt(a.Size))
+	}
+
+	for i, e := range d.Extensions {
+		provider, err := parseActorID(e.Provider)
+		if err != nil {
+			return nil, EmptyInt, xerrors.Errorf("extension %d: invalid provider(%s): %v", i, e.Provider, err)
+		}
+		if e.Size == 0 {
+			return nil, EmptyInt, xerrors.Errorf("extension %d: size of claim %d is required", i, e.ClaimID)
+		}
+		if abi.ChainEpoch(e.TermMax) > MaximumVerifiedAllocationTerm {
+			return nil, EmptyInt, xerrors.Errorf("extension %d: term_max %d exceeds %d", i, e.TermMax, MaximumVerifiedAllocationTerm)
+		}
+
+		reqs.Extensions = append(reqs.Extensions, ClaimExtensionRequest{
+			Provider: provider,
+			Claim:    e.ClaimID,
+			TermMax:  abi.ChainEpoch(e.TermMax),
+		})
+		total = BigAdd(total, NewInt(e.Size))
+	}
+
+	if total.IsZero() {
+		return nil, EmptyInt, xerrors.Errorf("no allocations or extensions requested")
+	}
+
+	return reqs, BigMul(total, DatacapTokenPrecision), nil
+}
+
+// GenDatacapTransferParam 用 DataCap 为存储提供者创建 allocation
+// 消息发送到 f07，方法 MethodsDatacap.Transfer，Value 为 0
+// 输入见 DatacapTransferInput，转账金额按 size 总和自动计算
+// 输出 {"param": "..."}
+func GenDatacapTransferParam(input string) string {
+	var d DatacapTransferInput
+	if err := json.Unmarshal([]byte(input), &d); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid input json: %s, %v", input, err))
+	}
+
+	reqs, amount, err := d.Transfer()
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	operatorData, err := SerializeParams(reqs)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize AllocationRequests: %v", err))
+	}
+
+	verifreg, _ := address.NewIDAddress(VerifiedRegistryActorID)
+	enc, err := SerializeParams(&DatacapTransferParams{
+		To:           verifreg,
+		Amount:       amount,
+		OperatorData: operatorData,
+	})
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize TransferParams: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+// GenDatacapBalanceParam 查询 DataCap 余额的参数，方法 MethodsDatacap.Balance
+func GenDatacapBalanceParam(addr string) string {
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid address(%s): %v", addr, err))
+	}
+
+	enc, err := SerializeParams(&a)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	return genOut(enc, nil)
+}
+
+type DatacapOut struct {
+	Err               string   `json:"err,omitempty"`
+	Balance           string   `json:"balance,omitempty"`
+	Bytes             string   `json:"bytes,omitempty"`
+	Size              string   `json:"size,omitempty"`
+	FromBalance       string   `json:"from_balance,omitempty"`
+	ToBalance         string   `json:"to_balance,omitempty"`
+	AllocationsPassed uint64   `json:"allocations_passed,omitempty"`
+	ExtensionsPassed  uint64   `json:"extensions_passed,omitempty"`
+	FailCodes         []string `json:"fail_codes,omitempty"`
+	AllocationIDs     []uint64 `json:"allocation_ids,omitempty"`
+}
+
+func datacapOut(o *DatacapOut, err error) string {
+	if err != nil {
+		o = &DatacapOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// DecodeDatacapBalance 解码 Balance 的返回值（base64）
+// 输出 {"balance": "token 单位", "bytes": "字节数", "size": "32 GiB"}
+func DecodeDatacapBalance(ret string) string {
+	b, err := base64.StdEncoding.DecodeString(ret)
+	if err != nil {
+		return datacapOut(nil, xerrors.Errorf("invalid return data: %v", err))
+	}
+
+	var balance abi.TokenAmount
+	if err := balance.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return datacapOut(nil, xerrors.Errorf("failed to decode balance: %v", err))
+	}
+
+	size := BigDiv(balance, DatacapTokenPrecision)
+	return datacapOut(&DatacapOut{
+		Balance: balance.String(),
+		Bytes:   size.String(),
+		Size:    SizeStr(size),
+	}, nil)
+}
+
+// DecodeDatacapTransferReturn 解码 Transfer 的返回值（base64）
+// 输出双方余额、成功的 allocation / extension 数量、失败码和新建的 allocation id
+func DecodeDatacapTransferReturn(ret string) string {
+	b, err := base64.StdEncoding.DecodeString(ret)
+	if err != nil {
+		return datacapOut(nil, xerrors.Errorf("invalid return data: %v", err))
+	}
+
+	var tr DatacapTransferReturn
+	if err := tr.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return datacapOut(nil, xerrors.Errorf("failed to decode TransferReturn: %v", err))
+	}
+
+	o := &DatacapOut{
+		FromBalance: tr.FromBalance.String(),
+		ToBalance:   tr.ToBalance.String(),
+	}
+
+	if len(tr.RecipientData) > 0 {
+		var resp AllocationsResponse
+		if err := resp.UnmarshalCBOR(bytes.NewReader(tr.RecipientData)); err != nil {
+			return datacapOut(nil, xerrors.Errorf("failed to decode AllocationsResponse: %v", err))
+		}
+		o.AllocationsPassed = resp.AllocationResults.SuccessCount
+		o.ExtensionsPassed = resp.ExtensionResults.SuccessCount
+		for _, fc := range resp.AllocationResults.FailCodes {
+			o.FailCodes = append(o.FailCodes, fmt.Sprintf("allocation %d: exit code %d", fc.Idx, fc.Code))
+		}
+		for _, fc := range resp.ExtensionResults.FailCodes {
+			o.FailCodes = append(o.FailCodes, fmt.Sprintf("extension %d: exit code %d", fc.Idx, fc.Code))
+		}
+		o.AllocationIDs = resp.NewAllocations
+	}
+
+	return datacapOut(o, nil)
+}
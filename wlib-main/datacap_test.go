@@ -0,0 +1,59 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestGenDatacapTransferParam(t *testing.T) {
+	o := parseOut(t, wlib.GenDatacapTransferParam(`{"allocations": [{
+		"provider": "f01234",
+		"data": "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq",
+		"size": 34359738368,
+		"term_min": 518400,
+		"term_max": 5256000,
+		"expiration": 3000000
+	}]}`))
+	require.Equal(t, "", o.Err)
+	// [f06, 32 GiB * 10^18, operator data]
+	require.Equal(t, "83420006", hex.EncodeToString(o.Param[:4]))
+
+	o = parseOut(t, wlib.GenDatacapTransferParam(`{"allocations": [{"provider": "f01234",
+		"data": "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq",
+		"size": 1000, "term_min": 518400, "term_max": 5256000}]}`))
+	require.Contains(t, o.Err, "power of two")
+
+	// 2^63 + 2^63 overflows uint64
+	var in wlib.DatacapTransferInput
+	require.NoError(t, json.Unmarshal([]byte(`{"allocations": [
+		{"provider": "f01234", "data": "baga6ea4seaqao7s73y24kcutaosvacpdjgfe5pw76ooefnyqw4ynr3d2y6x2mpq",
+		 "size": 9223372036854775808, "term_min": 518400, "term_max": 5256000}],
+		"extensions": [{"provider": "f01234", "claim_id": 7, "term_max": 5256000, "size": 9223372036854775808}]}`), &in))
+	_, amount, err := in.Transfer()
+	require.NoError(t, err)
+	require.Equal(t, "18446744073709551616000000000000000000", amount.String())
+}
+
+func TestGenDatacapBalanceParamDelegated(t *testing.T) {
+	f410 := wlib.EthAddressToFil("0xd4c5fb16488aa48081296299d54b0c648c9333da")
+	o := parseOut(t, wlib.GenDatacapBalanceParam(f410))
+	require.Equal(t, "", o.Err)
+	// cbor byte string of 22 bytes: protocol 4, namespace 10, then the eth address
+	require.Equal(t, "56040ad4", hex.EncodeToString(o.Param[:4]))
+}
+
+func TestDecodeDatacapTransferReturn(t *testing.T) {
+	recipient := []byte{0x83, 0x82, 0x01, 0x80, 0x82, 0x00, 0x80, 0x81, 0x05}
+	ret := append([]byte{0x83, 0x40, 0x40, 0x49}, recipient...)
+
+	var out wlib.DatacapOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DecodeDatacapTransferReturn(base64.StdEncoding.EncodeToString(ret))), &out))
+	require.Equal(t, "", out.Err)
+	require.Equal(t, uint64(1), out.AllocationsPassed)
+	require.Equal(t, []uint64{5}, out.AllocationIDs)
+}
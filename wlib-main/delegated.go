@@ -0,0 +1,120 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"golang.org/x/xerrors"
+)
+
+// EthereumAddressManagerActorID is the ID of the EAM (f010), which is also the
+// namespace of f410 addresses.
+const EthereumAddressManagerActorID = 10
+
+// EthAddressLength is the length of an Ethereum address in bytes.
+const EthAddressLength = 20
+
+func delegatedParts(a address.Address) (uint64, []byte, error) {
+	if a.Protocol() != address.Delegated {
+		return 0, nil, xerrors.Errorf("not a delegated address")
+	}
+
+	payload := a.Payload()
+	ns, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return 0, nil, address.ErrInvalidPayload
+	}
+
+	return ns, payload[n:], nil
+}
+
+// ethAddressFromFil converts f0 and f410 addresses to their 0x form. ID
+// addresses become "masked" addresses: 0xff, eleven zero bytes, then the ID.
+func ethAddressFromFil(a address.Address) ([]byte, error) {
+	switch a.Protocol() {
+	case address.ID:
+		id, err := address.IDFromAddress(a)
+		if err != nil {
+			return nil, err
+		}
+		eth := make([]byte, EthAddressLength)
+		eth[0] = 0xff
+		binary.BigEndian.PutUint64(eth[12:], id)
+		return eth, nil
+	case address.Delegated:
+		ns, sub, err := delegatedParts(a)
+		if err != nil {
+			return nil, err
+		}
+		if ns != EthereumAddressManagerActorID || len(sub) != EthAddressLength {
+			return nil, xerrors.Errorf("%s is not an Ethereum address", a.String())
+		}
+		return sub, nil
+	default:
+		return nil, xerrors.Errorf("%s has no Ethereum equivalent", a.String())
+	}
+}
+
+var maskedIDPrefix = append([]byte{0xff}, make([]byte, 11)...)
+
+// filAddressFromEth is the inverse of ethAddressFromFil.
+func filAddressFromEth(eth []byte) (address.Address, error) {
+	if len(eth) != EthAddressLength {
+		return address.Undef, xerrors.Errorf("eth address must be %d bytes, got %d", EthAddressLength, len(eth))
+	}
+
+	if bytes.HasPrefix(eth, maskedIDPrefix) {
+		return address.NewIDAddress(binary.BigEndian.Uint64(eth[12:]))
+	}
+
+	return address.NewDelegatedAddress(EthereumAddressManagerActorID, eth)
+}
+
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
+
+// parseEthOrFilAddress accepts either a 0x Ethereum address or a Filecoin address.
+func parseEthOrFilAddress(s string) (address.Address, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		eth, err := decodeHex(s)
+		if err != nil {
+			return address.Undef, xerrors.Errorf("invalid eth address(%s): %v", s, err)
+		}
+		return filAddressFromEth(eth)
+	}
+
+	return address.NewFromString(s)
+}
+
+// EthAddressToFil 将 0x 地址转换为 f0（掩码 ID 地址）或 f410 地址
+func EthAddressToFil(eth string) string {
+	a, err := parseEthOrFilAddress(eth)
+	if err != nil {
+		return ""
+	}
+
+	return a.String()
+}
+
+// FilAddressToEth 将 f0 或 f410 地址转换为 0x 地址
+func FilAddressToEth(addr string) string {
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return ""
+	}
+
+	eth, err := ethAddressFromFil(a)
+	if err != nil {
+		return ""
+	}
+
+	return "0x" + hex.EncodeToString(eth)
+}
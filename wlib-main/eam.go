@@ -0,0 +1,350 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// MethodsEAM are the method numbers of the Ethereum Address Manager (f010).
+var MethodsEAM = struct {
+	Constructor    abi.MethodNum
+	Create         abi.MethodNum
+	Create2        abi.MethodNum
+	CreateExternal abi.MethodNum
+}{1, 2, 3, 4}
+
+type EAMCreateParams struct {
+	Initcode []byte
+	Nonce    uint64
+}
+
+type EAMCreate2Params struct {
+	Initcode []byte
+	Salt     [32]byte
+}
+
+type EAMCreateReturn struct {
+	ActorID       uint64
+	RobustAddress *address.Address
+	EthAddress    [EthAddressLength]byte
+}
+
+func (t *EAMCreateParams) MarshalCBOR(w io.Writer) error {
+	scratch := make([]byte, 9)
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, 2); err != nil {
+		return err
+	}
+
+	// t.Initcode ([]uint8) (slice)
+	if len(t.Initcode) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field t.Initcode was too long")
+	}
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Initcode))); err != nil {
+		return err
+	}
+	if _, err := w.Write(t.Initcode); err != nil {
+		return err
+	}
+
+	// t.Nonce (uint64) (uint64)
+	return cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, t.Nonce)
+}
+
+func (t *EAMCreate2Params) MarshalCBOR(w io.Writer) error {
+	scratch := make([]byte, 9)
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, 2); err != nil {
+		return err
+	}
+
+	// t.Initcode ([]uint8) (slice)
+	if len(t.Initcode) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field t.Initcode was too long")
+	}
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Initcode))); err != nil {
+		return err
+	}
+	if _, err := w.Write(t.Initcode); err != nil {
+		return err
+	}
+
+	// t.Salt ([32]uint8) (array)
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Salt))); err != nil {
+		return err
+	}
+	_, err := w.Write(t.Salt[:])
+	return err
+}
+
+func (t *EAMCreateReturn) UnmarshalCBOR(r io.Reader) error {
+	*t = EAMCreateReturn{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+	if extra != 3 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.ActorID (uint64) (uint64)
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajUnsignedInt {
+		return fmt.Errorf("wrong type for uint64 field")
+	}
+	t.ActorID = extra
+
+	// t.RobustAddress (address.Address) (struct)
+	b, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b != cbg.CborNull[0] {
+		if err := br.UnreadByte(); err != nil {
+			return err
+		}
+		t.RobustAddress = new(address.Address)
+		if err := t.RobustAddress.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.RobustAddress: %w", err)
+		}
+	}
+
+	// t.EthAddress ([20]uint8) (array)
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajByteString {
+		return fmt.Errorf("expected byte array")
+	}
+	if extra != EthAddressLength {
+		return fmt.Errorf("expected array to have %d elements", EthAddressLength)
+	}
+	_, err = io.ReadFull(br, t.EthAddress[:])
+	return err
+}
+
+// ethAddressOf returns the address a contract deployer is known by inside
+// the EVM: the f410 subaddress, or the masked ID for any other actor.
+func ethAddressOf(a address.Address) ([]byte, error) {
+	if a.Protocol() == address.Delegated || a.Protocol() == address.ID {
+		return ethAddressFromFil(a)
+	}
+	return nil, xerrors.Errorf("%s must be an f0 or f410 address to deploy contracts", a.String())
+}
+
+// computeCreateAddress is keccak256(rlp([sender, nonce]))[12:].
+func computeCreateAddress(sender []byte, nonce uint64) []byte {
+	return keccak256(rlpEncodeList(rlpEncodeBytes(sender), rlpEncodeUint(nonce)))[12:]
+}
+
+// computeCreate2Address is keccak256(0xff ++ sender ++ salt ++ keccak256(initcode))[12:].
+func computeCreate2Address(sender []byte, salt [32]byte, initcode []byte) []byte {
+	buf := append([]byte{0xff}, sender...)
+	buf = append(buf, salt[:]...)
+	buf = append(buf, keccak256(initcode)...)
+	return keccak256(buf)[12:]
+}
+
+func parseSalt(s string) ([32]byte, error) {
+	var salt [32]byte
+	b, err := decodeHex(s)
+	if err != nil {
+		return salt, xerrors.Errorf("invalid salt(%s): %v", s, err)
+	}
+	if len(b) > len(salt) {
+		return salt, xerrors.Errorf("salt must be at most 32 bytes, got %d", len(b))
+	}
+	copy(salt[len(salt)-len(b):], b)
+	return salt, nil
+}
+
+func eamMsg(from string, method abi.MethodNum, params cbg.CBORMarshaler) (*Msg, error) {
+	sender, err := address.NewFromString(from)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid from address(%s): %v", from, err)
+	}
+
+	enc, err := SerializeParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	eam, _ := address.NewIDAddress(EthereumAddressManagerActorID)
+	return &Msg{
+		To:         eam.String(),
+		From:       sender.String(),
+		Value:      "0",
+		GasFeeCap:  "0",
+		GasPremium: "0",
+		Method:     uint64(method),
+		Params:     base64.StdEncoding.EncodeToString(enc),
+	}, nil
+}
+
+// cborBytesParams serializes as a plain CBOR byte string, the params of CreateExternal.
+type cborBytesParams []byte
+
+func (b cborBytesParams) MarshalCBOR(w io.Writer) error {
+	enc, err := cborBytes(b)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(enc)
+	return err
+}
+
+// GenEAMCreate 构造通过 EAM (f010) Create 部署合约的消息
+// initcode 为十六进制合约字节码，nonce 参与合约地址计算
+// 输出 Msg json，合约地址可用 ComputeCreateAddress(from, nonce) 提前算出
+func GenEAMCreate(from, initcode string, nonce int64) string {
+	if nonce < 0 {
+		return genOut(nil, xerrors.Errorf("invalid nonce(%d)", nonce))
+	}
+	code, err := decodeHex(initcode)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid initcode: %v", err))
+	}
+
+	return msgOut(eamMsg(from, MethodsEAM.Create, &EAMCreateParams{Initcode: code, Nonce: uint64(nonce)}))
+}
+
+// GenEAMCreate2 构造 Create2 部署消息，salt 为 32 字节十六进制
+// 合约地址可用 ComputeCreate2Address(from, salt, initcode) 提前算出
+func GenEAMCreate2(from, initcode, salt string) string {
+	code, err := decodeHex(initcode)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid initcode: %v", err))
+	}
+
+	s, err := parseSalt(salt)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	return msgOut(eamMsg(from, MethodsEAM.Create2, &EAMCreate2Params{Initcode: code, Salt: s}))
+}
+
+// GenEAMCreateExternal 构造 f410 账户部署合约的消息
+// 合约地址为 ComputeCreateAddress(from, 消息的 nonce)
+func GenEAMCreateExternal(from, initcode string) string {
+	code, err := decodeHex(initcode)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid initcode: %v", err))
+	}
+
+	return msgOut(eamMsg(from, MethodsEAM.CreateExternal, cborBytesParams(code)))
+}
+
+// ComputeCreateAddress 计算 Create / CreateExternal 部署的合约 f410 地址，nonce 为负时返回空
+func ComputeCreateAddress(from string, nonce int64) string {
+	if nonce < 0 {
+		return ""
+	}
+	sender, err := address.NewFromString(from)
+	if err != nil {
+		return ""
+	}
+
+	eth, err := ethAddressOf(sender)
+	if err != nil {
+		return ""
+	}
+
+	a, err := address.NewDelegatedAddress(EthereumAddressManagerActorID, computeCreateAddress(eth, uint64(nonce)))
+	if err != nil {
+		return ""
+	}
+	return a.String()
+}
+
+// ComputeCreate2Address 计算 Create2 部署的合约 f410 地址
+func ComputeCreate2Address(from, salt, initcode string) string {
+	sender, err := address.NewFromString(from)
+	if err != nil {
+		return ""
+	}
+
+	eth, err := ethAddressOf(sender)
+	if err != nil {
+		return ""
+	}
+
+	s, err := parseSalt(salt)
+	if err != nil {
+		return ""
+	}
+
+	code, err := decodeHex(initcode)
+	if err != nil {
+		return ""
+	}
+
+	a, err := address.NewDelegatedAddress(EthereumAddressManagerActorID, computeCreate2Address(eth, s, code))
+	if err != nil {
+		return ""
+	}
+	return a.String()
+}
+
+type CreateReturnOut struct {
+	Err           string `json:"err,omitempty"`
+	ActorID       uint64 `json:"actor_id,omitempty"`
+	IDAddress     string `json:"id_address,omitempty"`
+	RobustAddress string `json:"robust_address,omitempty"`
+	EthAddress    string `json:"eth_address,omitempty"`
+	Address       string `json:"address,omitempty"`
+}
+
+// DecodeCreateReturn 解码 Create / Create2 / CreateExternal 回执中的 Return（base64）
+// 输出 {"actor_id": 1234, "id_address": "f01234", "robust_address": "f2...",
+// "eth_address": "0x...", "address": "f410f..."}
+func DecodeCreateReturn(ret string) string {
+	b, err := base64.StdEncoding.DecodeString(ret)
+	if err != nil {
+		return jsonOut(&CreateReturnOut{Err: fmt.Sprintf("invalid return data: %v", err)})
+	}
+
+	var cr EAMCreateReturn
+	if err := cr.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return jsonOut(&CreateReturnOut{Err: fmt.Sprintf("failed to decode CreateReturn: %v", err)})
+	}
+
+	id, err := address.NewIDAddress(cr.ActorID)
+	if err != nil {
+		return jsonOut(&CreateReturnOut{Err: err.Error()})
+	}
+
+	f410, err := address.NewDelegatedAddress(EthereumAddressManagerActorID, cr.EthAddress[:])
+	if err != nil {
+		return jsonOut(&CreateReturnOut{Err: err.Error()})
+	}
+
+	o := &CreateReturnOut{
+		ActorID:    cr.ActorID,
+		IDAddress:  id.String(),
+		EthAddress: "0x" + hex.EncodeToString(cr.EthAddress[:]),
+		Address:    f410.String(),
+	}
+	if cr.RobustAddress != nil {
+		o.RobustAddress = cr.RobustAddress.String()
+	}
+
+	return jsonOut(o)
+}
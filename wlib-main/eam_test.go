@@ -0,0 +1,53 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestComputeContractAddress(t *testing.T) {
+	sender := wlib.EthAddressToFil("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	require.Equal(t, "0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d", wlib.FilAddressToEth(wlib.ComputeCreateAddress(sender, 0)))
+	require.Equal(t, "0x343c43a37d37dff08ae8c4a11544c718abb4fcf8", wlib.FilAddressToEth(wlib.ComputeCreateAddress(sender, 1)))
+
+	// EIP-1014 examples
+	zero := wlib.EthAddressToFil("0x0000000000000000000000000000000000000000")
+	require.Equal(t, "0x4d1a2e2bb4f88f0250f26ffff098b0b30b26bf38", wlib.FilAddressToEth(wlib.ComputeCreate2Address(zero, "0x00", "0x00")))
+	deadbeef := wlib.EthAddressToFil("0xdeadbeef00000000000000000000000000000000")
+	require.Equal(t, "0xb928f69bb1d91cd65274e3c79d8986362984fda3", wlib.FilAddressToEth(wlib.ComputeCreate2Address(deadbeef, "0x00", "0x00")))
+
+	require.Equal(t, "", wlib.ComputeCreateAddress("t1lrgw6ss5nu5lbhqmmtthc7hmxg6hlt5r6txpy3i", 0))
+	require.Equal(t, "", wlib.ComputeCreateAddress(sender, -1))
+}
+
+func TestGenEAMCreate(t *testing.T) {
+	var msg wlib.Msg
+	require.NoError(t, json.Unmarshal([]byte(wlib.GenEAMCreateExternal(wlib.EthAddressToFil("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0"), "0x6080")), &msg))
+	require.Equal(t, "t010", msg.To)
+	require.Equal(t, uint64(4), msg.Method)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte{0x42, 0x60, 0x80}), msg.Params)
+
+	require.NoError(t, json.Unmarshal([]byte(wlib.GenEAMCreate("t01000", "0x6080", 7)), &msg))
+	require.Equal(t, uint64(2), msg.Method)
+	require.Equal(t, base64.StdEncoding.EncodeToString([]byte{0x82, 0x42, 0x60, 0x80, 0x07}), msg.Params)
+
+	require.Contains(t, parseOut(t, wlib.GenEAMCreate("t01000", "0x6080", -1)).Err, "invalid nonce")
+}
+
+func TestDecodeCreateReturn(t *testing.T) {
+	eth, _ := hex.DecodeString("cd234a471b72ba2f1ccf0a70fcaba648a5eecd8d")
+	ret := append([]byte{0x83, 0x19, 0x04, 0xd2, 0xf6, 0x54}, eth...)
+
+	var out wlib.CreateReturnOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DecodeCreateReturn(base64.StdEncoding.EncodeToString(ret))), &out))
+	require.Equal(t, "", out.Err)
+	require.Equal(t, uint64(1234), out.ActorID)
+	require.Equal(t, "t01234", out.IDAddress)
+	require.Equal(t, "0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d", out.EthAddress)
+	require.Equal(t, wlib.EthAddressToFil(out.EthAddress), out.Address)
+}
@@ -0,0 +1,524 @@
+package wlib
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/filecoin-project/go-address"
+	crypto "github.com/filecoin-project/go-crypto"
+	"github.com/filecoin-project/go-state-types/abi"
+	crypto2 "github.com/filecoin-project/go-state-types/crypto"
+	"golang.org/x/xerrors"
+)
+
+const (
+	EthChainIDMainnet  = 314
+	EthChainIDCalibnet = 314159
+
+	eip1559TxType = 0x02
+)
+
+// EthTx is an EIP-1559 transaction as accepted by the Filecoin network for
+// f410 accounts. To is nil for contract creation. V, R and S are unset for
+// an unsigned transaction.
+type EthTx struct {
+	ChainID              uint64
+	Nonce                uint64
+	To                   []byte
+	Value                BigInt
+	MaxFeePerGas         BigInt
+	MaxPriorityFeePerGas BigInt
+	GasLimit             uint64
+	Input                []byte
+
+	V, R, S BigInt
+}
+
+func rlpEncodeBigs(names []string, ns ...BigInt) ([][]byte, error) {
+	out := make([][]byte, len(ns))
+	for i, n := range ns {
+		b, err := rlpEncodeBig(n)
+		if err != nil {
+			return nil, xerrors.Errorf("%s: %v", names[i], err)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
+
+func (tx *EthTx) rlpFields() ([][]byte, error) {
+	b, err := rlpEncodeBigs([]string{"maxPriorityFeePerGas", "maxFeePerGas", "value"},
+		tx.MaxPriorityFeePerGas, tx.MaxFeePerGas, tx.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{
+		rlpEncodeUint(tx.ChainID),
+		rlpEncodeUint(tx.Nonce),
+		b[0],
+		b[1],
+		rlpEncodeUint(tx.GasLimit),
+		rlpEncodeBytes(tx.To),
+		b[2],
+		rlpEncodeBytes(tx.Input),
+		rlpEncodeList(), // access list, always empty on Filecoin
+	}, nil
+}
+
+// UnsignedRLP is 0x02 || rlp([chainId, nonce, ..., accessList]).
+func (tx *EthTx) UnsignedRLP() ([]byte, error) {
+	fields, err := tx.rlpFields()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{eip1559TxType}, rlpEncodeList(fields...)...), nil
+}
+
+// SignedRLP is the raw transaction as sent to eth_sendRawTransaction.
+func (tx *EthTx) SignedRLP() ([]byte, error) {
+	if tx.R.Int == nil || tx.S.Int == nil || tx.V.Int == nil {
+		return nil, xerrors.Errorf("transaction is not signed")
+	}
+
+	fields, err := tx.rlpFields()
+	if err != nil {
+		return nil, err
+	}
+	vrs, err := rlpEncodeBigs([]string{"v", "r", "s"}, tx.V, tx.R, tx.S)
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields, vrs...)
+	return append([]byte{eip1559TxType}, rlpEncodeList(fields...)...), nil
+}
+
+// SigningHash is the keccak256 digest signed by the sender.
+func (tx *EthTx) SigningHash() ([]byte, error) {
+	raw, err := tx.UnsignedRLP()
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(raw), nil
+}
+
+// Hash is the Ethereum transaction hash, the same one Lotus reports.
+func (tx *EthTx) Hash() ([]byte, error) {
+	raw, err := tx.SignedRLP()
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(raw), nil
+}
+
+// Signature returns the delegated signature: r || s || v.
+func (tx *EthTx) Signature() (*crypto2.Signature, error) {
+	if tx.R.Int == nil || tx.S.Int == nil || tx.V.Int == nil {
+		return nil, xerrors.Errorf("transaction is not signed")
+	}
+	if tx.R.BitLen() > 256 || tx.S.BitLen() > 256 || !tx.V.IsUint64() || tx.V.Uint64() > 1 {
+		return nil, xerrors.Errorf("invalid signature values")
+	}
+
+	sig := make([]byte, 65)
+	tx.R.FillBytes(sig[:32])
+	tx.S.FillBytes(sig[32:64])
+	sig[64] = byte(tx.V.Uint64())
+	return &crypto2.Signature{Type: SigTypeDelegated, Data: sig}, nil
+}
+
+func (tx *EthTx) setSignature(sig []byte) error {
+	if len(sig) != 65 {
+		return xerrors.Errorf("signature must be 65 bytes, got %d", len(sig))
+	}
+
+	tx.R = BigInt{Int: new(big.Int).SetBytes(sig[:32])}
+	tx.S = BigInt{Int: new(big.Int).SetBytes(sig[32:64])}
+	tx.V = NewInt(uint64(sig[64]))
+	return nil
+}
+
+// Sender recovers the f410 address that signed the transaction.
+func (tx *EthTx) Sender() (address.Address, error) {
+	sig, err := tx.Signature()
+	if err != nil {
+		return address.Undef, err
+	}
+
+	h, err := tx.SigningHash()
+	if err != nil {
+		return address.Undef, err
+	}
+	pk, err := crypto.EcRecover(h, sig.Data)
+	if err != nil {
+		return address.Undef, xerrors.Errorf("failed to recover sender: %v", err)
+	}
+
+	return ethAccountAddress(pk)
+}
+
+// ethAccountAddress derives the f410 address of an uncompressed secp256k1 public key.
+func ethAccountAddress(pk []byte) (address.Address, error) {
+	if len(pk) != 65 {
+		return address.Undef, xerrors.Errorf("expected an uncompressed public key, got %d bytes", len(pk))
+	}
+	return address.NewDelegatedAddress(EthereumAddressManagerActorID, keccak256(pk[1:])[12:])
+}
+
+// ToMessage converts the transaction into the Filecoin message Lotus
+// executes for it: InvokeContract on the target, or EAM CreateExternal
+// when To is nil.
+func (tx *EthTx) ToMessage(from address.Address) (*Message, error) {
+	if tx.GasLimit > 1<<63-1 {
+		return nil, xerrors.Errorf("gas limit %d overflows int64", tx.GasLimit)
+	}
+
+	var (
+		to     address.Address
+		method abi.MethodNum
+		params []byte
+		err    error
+	)
+	if tx.To == nil {
+		to, _ = address.NewIDAddress(EthereumAddressManagerActorID)
+		method = MethodsEAM.CreateExternal
+	} else {
+		if to, err = filAddressFromEth(tx.To); err != nil {
+			return nil, err
+		}
+		method = MethodsEVM.InvokeContract
+	}
+	if len(tx.Input) > 0 || tx.To == nil {
+		if params, err = cborBytes(tx.Input); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Message{
+		Version:    0,
+		To:         to,
+		From:       from,
+		Nonce:      tx.Nonce,
+		Value:      tx.Value,
+		GasLimit:   int64(tx.GasLimit),
+		GasFeeCap:  tx.MaxFeePerGas,
+		GasPremium: tx.MaxPriorityFeePerGas,
+		Method:     method,
+		Params:     params,
+	}, nil
+}
+
+// ToSignedMessage recovers the sender and returns the delegated-signed message.
+func (tx *EthTx) ToSignedMessage() (*SignedMessage, error) {
+	from, err := tx.Sender()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := tx.ToMessage(from)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := tx.Signature()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedMessage{Message: *msg, Signature: *sig}, nil
+}
+
+// checkEthChainID only accepts the Filecoin chain IDs, so a transaction
+// signed here cannot be replayed on another EVM chain.
+func checkEthChainID(chainID uint64) error {
+	if chainID != EthChainIDMainnet && chainID != EthChainIDCalibnet {
+		return xerrors.Errorf("unsupported chain id %d, expected %d or %d", chainID, EthChainIDMainnet, EthChainIDCalibnet)
+	}
+	return nil
+}
+
+// EthTxFromMessage is the inverse of EthTx.ToMessage. chainID must be
+// EthChainIDMainnet or EthChainIDCalibnet.
+func EthTxFromMessage(msg *Message, chainID uint64) (*EthTx, error) {
+	if err := checkEthChainID(chainID); err != nil {
+		return nil, err
+	}
+	if msg.Version != 0 {
+		return nil, xerrors.Errorf("unsupported message version %d", msg.Version)
+	}
+	if msg.From.Protocol() != address.Delegated {
+		return nil, xerrors.Errorf("sender %s is not an f410 address", msg.From.String())
+	}
+	if msg.GasLimit < 0 {
+		return nil, xerrors.Errorf("negative gas limit")
+	}
+
+	tx := &EthTx{
+		ChainID:              chainID,
+		Nonce:                msg.Nonce,
+		Value:                msg.Value,
+		MaxFeePerGas:         msg.GasFeeCap,
+		MaxPriorityFeePerGas: msg.GasPremium,
+		GasLimit:             uint64(msg.GasLimit),
+	}
+
+	eam, _ := address.NewIDAddress(EthereumAddressManagerActorID)
+	switch {
+	case msg.To == eam && msg.Method == MethodsEAM.CreateExternal:
+	case msg.Method == MethodsEVM.InvokeContract:
+		to, err := ethAddressFromFil(msg.To)
+		if err != nil {
+			return nil, err
+		}
+		tx.To = to
+	default:
+		return nil, xerrors.Errorf("method %d to %s cannot be expressed as an Ethereum transaction", msg.Method, msg.To.String())
+	}
+
+	input, err := unwrapCborBytes(msg.Params)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid params: %v", err)
+	}
+	tx.Input = input
+
+	return tx, nil
+}
+
+// ParseEthTx decodes a raw signed or unsigned EIP-1559 transaction for the
+// Filecoin mainnet or calibnet.
+func ParseEthTx(raw []byte) (*EthTx, error) {
+	if len(raw) == 0 || raw[0] != eip1559TxType {
+		return nil, xerrors.Errorf("not an EIP-1559 transaction")
+	}
+
+	it, rest, err := rlpDecode(raw[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, xerrors.Errorf("trailing bytes after transaction")
+	}
+
+	fields, ok := it.([]interface{})
+	if !ok || (len(fields) != 9 && len(fields) != 12) {
+		return nil, xerrors.Errorf("expected a list of 9 or 12 fields")
+	}
+
+	tx := new(EthTx)
+	if tx.ChainID, err = rlpUint(fields[0]); err != nil {
+		return nil, xerrors.Errorf("chainId: %v", err)
+	}
+	if err := checkEthChainID(tx.ChainID); err != nil {
+		return nil, err
+	}
+	if tx.Nonce, err = rlpUint(fields[1]); err != nil {
+		return nil, xerrors.Errorf("nonce: %v", err)
+	}
+	if tx.MaxPriorityFeePerGas, err = rlpBig(fields[2]); err != nil {
+		return nil, xerrors.Errorf("maxPriorityFeePerGas: %v", err)
+	}
+	if tx.MaxFeePerGas, err = rlpBig(fields[3]); err != nil {
+		return nil, xerrors.Errorf("maxFeePerGas: %v", err)
+	}
+	if tx.GasLimit, err = rlpUint(fields[4]); err != nil {
+		return nil, xerrors.Errorf("gasLimit: %v", err)
+	}
+	if tx.To, err = rlpBytes(fields[5]); err != nil {
+		return nil, xerrors.Errorf("to: %v", err)
+	}
+	switch len(tx.To) {
+	case 0:
+		tx.To = nil
+	case EthAddressLength:
+	default:
+		return nil, xerrors.Errorf("to: expected %d bytes, got %d", EthAddressLength, len(tx.To))
+	}
+	if tx.Value, err = rlpBig(fields[6]); err != nil {
+		return nil, xerrors.Errorf("value: %v", err)
+	}
+	if tx.Input, err = rlpBytes(fields[7]); err != nil {
+		return nil, xerrors.Errorf("input: %v", err)
+	}
+	if al, ok := fields[8].([]interface{}); !ok || len(al) != 0 {
+		return nil, xerrors.Errorf("access lists are not supported")
+	}
+
+	if len(fields) == 12 {
+		if tx.V, err = rlpBig(fields[9]); err != nil {
+			return nil, xerrors.Errorf("v: %v", err)
+		}
+		if tx.R, err = rlpBig(fields[10]); err != nil {
+			return nil, xerrors.Errorf("r: %v", err)
+		}
+		if tx.S, err = rlpBig(fields[11]); err != nil {
+			return nil, xerrors.Errorf("s: %v", err)
+		}
+	}
+
+	return tx, nil
+}
+
+type EthTxOut struct {
+	Err         string `json:"err,omitempty"`
+	Message     *Msg   `json:"message,omitempty"`
+	Signature   []byte `json:"signature,omitempty"`
+	Cid         string `json:"cid,omitempty"`
+	EthHash     string `json:"eth_hash,omitempty"`
+	RawTx       string `json:"raw_tx,omitempty"`
+	SigningHash string `json:"signing_hash,omitempty"`
+}
+
+func ethTxOut(o *EthTxOut, err error) string {
+	if err != nil {
+		o = &EthTxOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+func signedEthTxOut(tx *EthTx) (*EthTxOut, error) {
+	sm, err := tx.ToSignedMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := tx.SignedRLP()
+	if err != nil {
+		return nil, err
+	}
+	h, err := tx.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &EthTxOut{
+		Message:     newMsg(&sm.Message),
+		Signature:   sm.Signature.Data,
+		Cid:         sm.Cid().String(),
+		EthHash:     "0x" + hex.EncodeToString(keccak256(raw)),
+		RawTx:       "0x" + hex.EncodeToString(raw),
+		SigningHash: "0x" + hex.EncodeToString(h),
+	}, nil
+}
+
+func unsignedEthTxOut(m *Msg, tx *EthTx) (*EthTxOut, error) {
+	raw, err := tx.UnsignedRLP()
+	if err != nil {
+		return nil, err
+	}
+
+	return &EthTxOut{
+		Message:     m,
+		RawTx:       "0x" + hex.EncodeToString(raw),
+		SigningHash: "0x" + hex.EncodeToString(keccak256(raw)),
+	}, nil
+}
+
+// EthTxToMessage 将 MetaMask 等钱包签名的 EIP-1559 交易（0x 十六进制）转换为 Filecoin 消息
+// 输出 {"message": Msg, "signature": "base64 r||s||v", "cid": "...", "eth_hash": "0x...", ...}
+// 未签名的交易只输出 message（from 为空）和 signing_hash
+func EthTxToMessage(raw string) string {
+	b, err := decodeHex(raw)
+	if err != nil {
+		return ethTxOut(nil, xerrors.Errorf("invalid raw transaction: %v", err))
+	}
+
+	tx, err := ParseEthTx(b)
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	if tx.V.Int != nil {
+		return ethTxOut(signedEthTxOut(tx))
+	}
+
+	msg, err := tx.ToMessage(address.Undef)
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+	m := newMsg(msg)
+	m.From = ""
+
+	return ethTxOut(unsignedEthTxOut(m, tx))
+}
+
+// MessageToEthTx 将 f410 发出的消息转换为未签名的 EIP-1559 交易
+// chainID 只能是主网 314 或校准网 314159
+// 输出 {"raw_tx": "0x02...", "signing_hash": "0x..."}
+func MessageToEthTx(msgJSON string, chainID int64) string {
+	if chainID < 0 {
+		return ethTxOut(nil, xerrors.Errorf("unsupported chain id %d", chainID))
+	}
+	msg, err := parseMsg(msgJSON)
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	tx, err := EthTxFromMessage(msg, uint64(chainID))
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	return ethTxOut(unsignedEthTxOut(newMsg(msg), tx))
+}
+
+// DelegatedSign 用 secp256k1 私钥（base64）以 delegated 签名类型签署 f410 发出的消息
+// 消息的 from 必须是该私钥对应的 f410 地址，chainID 只能是主网 314 或校准网 314159
+// 输出签名后的 message、signature、cid、eth_hash 和 raw_tx
+func DelegatedSign(ck, msgJSON string, chainID int64) string {
+	if chainID < 0 {
+		return ethTxOut(nil, xerrors.Errorf("unsupported chain id %d", chainID))
+	}
+	key, err := base64.StdEncoding.DecodeString(ck)
+	if err != nil {
+		return ethTxOut(nil, xerrors.Errorf("invalid private key: %v", err))
+	}
+
+	msg, err := parseMsg(msgJSON)
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	signer, err := ethAccountAddress(crypto.PublicKey(key))
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+	if msg.From != signer {
+		return ethTxOut(nil, xerrors.Errorf("message is from %s but the key belongs to %s", msg.From.String(), signer.String()))
+	}
+
+	tx, err := EthTxFromMessage(msg, uint64(chainID))
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	h, err := tx.SigningHash()
+	if err != nil {
+		return ethTxOut(nil, err)
+	}
+	sig, err := crypto.Sign(key, h)
+	if err != nil {
+		return ethTxOut(nil, xerrors.Errorf("failed to sign: %v", err))
+	}
+	if err := tx.setSignature(sig); err != nil {
+		return ethTxOut(nil, err)
+	}
+
+	return ethTxOut(signedEthTxOut(tx))
+}
+
+// EthAccountAddress 由 secp256k1 公钥（base64，65 字节）生成 f410 地址
+func EthAccountAddress(pk string) string {
+	b, err := base64.StdEncoding.DecodeString(pk)
+	if err != nil {
+		return ""
+	}
+
+	a, err := ethAccountAddress(b)
+	if err != nil {
+		return ""
+	}
+
+	return a.String()
+}
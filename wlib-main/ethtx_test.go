@@ -0,0 +1,92 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestDelegatedSignRoundTrip(t *testing.T) {
+	ck := "67WMRDA2ldmfcQ87DSHCy+ppKs3iSyNjxfBD7dR68Qw="
+	from := wlib.EthAccountAddress(wlib.SecpPrivateToPublic(ck))
+	require.True(t, strings.HasPrefix(from, "t410f"))
+
+	var msg wlib.Msg
+	require.NoError(t, json.Unmarshal([]byte(wlib.GenInvokeContract(from, "0xd4c5fb16488aa48081296299d54b0c648c9333da",
+		"transfer(address,uint256)", `["0xff000000000000000000000000000000000004d2", "1000"]`, "5")), &msg))
+	msg.Nonce = 3
+	msg.GasLimit = 2000000
+	msg.GasFeeCap = "150000"
+	msg.GasPremium = "1000"
+	payload, err := json.Marshal(msg)
+	require.NoError(t, err)
+
+	var signed wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DelegatedSign(ck, string(payload), wlib.EthChainIDCalibnet)), &signed))
+	require.Equal(t, "", signed.Err)
+	require.Len(t, signed.Signature, 65)
+	require.Equal(t, msg, *signed.Message)
+
+	var parsed wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.EthTxToMessage(signed.RawTx)), &parsed))
+	require.Equal(t, "", parsed.Err)
+	require.Equal(t, signed, parsed)
+
+	var unsigned wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.MessageToEthTx(string(payload), wlib.EthChainIDCalibnet)), &unsigned))
+	require.Equal(t, signed.SigningHash, unsigned.SigningHash)
+
+	other := wlib.DelegatedSign("p7ZGtfT3MyOdkVaEaE2LzT12fcl2N95jsiYuvBZZ1NA=", string(payload), wlib.EthChainIDCalibnet)
+	require.Contains(t, other, "key belongs to")
+}
+
+// The unsigned transaction is assembled by hand from EIP-1559:
+// 0x02 || rlp([chainId 314, nonce 0, tip 1000, feeCap 150000, gas 2000000, to, value 5, input "", []]).
+// The key is the private key 1, whose Ethereum address 0x7e5f...5bdf is well known.
+// Signatures are RFC 6979 deterministic (libsecp256k1, same as geth), so r, s and
+// the transaction hash are stable.
+func TestEthTxVector(t *testing.T) {
+	key := "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAE="
+	from := wlib.EthAccountAddress(wlib.SecpPrivateToPublic(key))
+	require.Equal(t, "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf", wlib.FilAddressToEth(from))
+
+	msg := `{"version": 0, "to": "` + wlib.EthAddressToFil("0xd4c5fb16488aa48081296299d54b0c648c9333da") + `", "from": "` + from + `",
+		"nonce": 0, "value": "5", "gaslimit": 2000000, "gasfeecap": "150000", "gaspremium": "1000", "method": 3844450837, "params": ""}`
+
+	var unsigned wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.MessageToEthTx(msg, wlib.EthChainIDMainnet)), &unsigned))
+	require.Equal(t, "", unsigned.Err)
+	require.Equal(t, "0x02"+"e7"+"82013a"+"80"+"8203e8"+"830249f0"+"831e8480"+
+		"94d4c5fb16488aa48081296299d54b0c648c9333da"+"05"+"80"+"c0", unsigned.RawTx)
+	require.Equal(t, "0x2d88b8bab82196a7a16f24496219346be76ae3410a7426a868c3a9b0ba1e66f1", unsigned.SigningHash)
+
+	var signed wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DelegatedSign(key, msg, wlib.EthChainIDMainnet)), &signed))
+	require.Equal(t, "", signed.Err)
+	require.Equal(t, "0x02f86a82013a808203e8830249f0831e848094d4c5fb16488aa48081296299d54b0c648c9333da0580c0"+
+		"80"+
+		"a0c2e89eff072c45091579bb434b82d0db92684f89c8322667e618bbe777a54b61"+
+		"a0212b4d98aa601929ee78ad7b3cbd99567ef44332264dbcc36bad1841aee3e549", signed.RawTx)
+	require.Equal(t, "0xc7998fe0e02ea54bee1dcfcee04074dc6af7996cf81bf9d277d99e07a4655953", signed.EthHash)
+	require.Equal(t, "bafy2bzaceczfpk6rq7lm24ahg4367c6fkpuofuwn4raixmjdicxlx3dorqlnu", signed.Cid)
+
+	// the sender is recovered from the raw transaction alone
+	var parsed wlib.EthTxOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.EthTxToMessage(signed.RawTx)), &parsed))
+	require.Equal(t, from, parsed.Message.From)
+
+	negative := strings.Replace(msg, `"value": "5"`, `"value": "-5"`, 1)
+	require.Contains(t, wlib.MessageToEthTx(negative, wlib.EthChainIDMainnet), "negative")
+
+	// only the Filecoin chain IDs are accepted, a signature for chain 1 could be replayed on Ethereum
+	for _, id := range []int64{0, 1, -314} {
+		require.Contains(t, wlib.MessageToEthTx(msg, id), "unsupported chain id")
+		require.Contains(t, wlib.DelegatedSign(key, msg, id), "unsupported chain id")
+	}
+	mainnetTx := "0x02" + "e5" + "01" + "80" + "8203e8" + "830249f0" + "831e8480" +
+		"94d4c5fb16488aa48081296299d54b0c648c9333da" + "05" + "80" + "c0"
+	require.Contains(t, wlib.EthTxToMessage(mainnetTx), "unsupported chain id 1")
+}
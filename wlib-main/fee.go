@@ -0,0 +1,199 @@
+package wlib
+
+import (
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+// 超额 gas 的燃烧比例，与 lotus 的 gasOveruseNum / gasOveruseDenom 一致
+const (
+	gasOveruseNum   = 11
+	gasOveruseDenom = 10
+)
+
+// GasOutputs 是一条消息执行后 gas 费用的分配，单位 attoFIL
+type GasOutputs struct {
+	BaseFeeBurn        BigInt
+	OverEstimationBurn BigInt
+	MinerPenalty       BigInt
+	MinerTip           BigInt
+	Refund             BigInt
+
+	GasRefund int64
+	GasBurned int64
+}
+
+// TotalCost 发送方实际支付的手续费
+func (o GasOutputs) TotalCost() BigInt {
+	return BigAdd(BigAdd(o.BaseFeeBurn, o.OverEstimationBurn), o.MinerTip)
+}
+
+// ComputeGasOverestimationBurn 计算 gasLimit 超出 gasUsed 部分中需要燃烧的 gas
+// 返回 (退还的 gas, 燃烧的 gas)
+func ComputeGasOverestimationBurn(gasUsed, gasLimit int64) (int64, int64) {
+	if gasUsed == 0 {
+		return 0, gasLimit
+	}
+
+	over := gasLimit - (gasOveruseNum*gasUsed)/gasOveruseDenom
+	if over < 0 {
+		return gasLimit - gasUsed, 0
+	}
+	if over > gasUsed {
+		over = gasUsed
+	}
+
+	gasToBurn := BigMul(NewInt(uint64(gasLimit-gasUsed)), NewInt(uint64(over)))
+	gasToBurn = BigDiv(gasToBurn, NewInt(uint64(gasUsed)))
+
+	return gasLimit - gasUsed - gasToBurn.Int64(), gasToBurn.Int64()
+}
+
+// ComputeGasOutputs 按 Filecoin 的 gas 规则（FIP-0002 / EIP-1559）计算费用分配
+func ComputeGasOutputs(gasUsed, gasLimit int64, baseFee, feeCap, gasPremium BigInt) GasOutputs {
+	gasUsedBig := NewInt(uint64(gasUsed))
+	out := GasOutputs{
+		OverEstimationBurn: NewInt(0),
+		MinerPenalty:       NewInt(0),
+	}
+
+	baseFeeToPay := baseFee
+	if baseFee.GreaterThan(feeCap) {
+		baseFeeToPay = feeCap
+		out.MinerPenalty = BigMul(BigSub(baseFee, feeCap), gasUsedBig)
+	}
+	out.BaseFeeBurn = BigMul(baseFeeToPay, gasUsedBig)
+
+	minerTip := gasPremium
+	if BigAdd(baseFeeToPay, minerTip).GreaterThan(feeCap) {
+		minerTip = BigSub(feeCap, baseFeeToPay)
+	}
+	out.MinerTip = BigMul(minerTip, NewInt(uint64(gasLimit)))
+
+	out.GasRefund, out.GasBurned = ComputeGasOverestimationBurn(gasUsed, gasLimit)
+	if out.GasBurned != 0 {
+		out.OverEstimationBurn = BigMul(baseFeeToPay, NewInt(uint64(out.GasBurned)))
+		out.MinerPenalty = BigAdd(out.MinerPenalty, BigMul(BigSub(baseFee, baseFeeToPay), NewInt(uint64(out.GasBurned))))
+	}
+
+	maxFee := BigMul(feeCap, NewInt(uint64(gasLimit)))
+	out.Refund = BigSub(BigSub(BigSub(maxFee, out.BaseFeeBurn), out.OverEstimationBurn), out.MinerTip)
+	return out
+}
+
+// MaxFee 消息最多支付的手续费 GasFeeCap * GasLimit
+func (m *Message) MaxFee() BigInt {
+	return BigMul(m.GasFeeCap, NewInt(uint64(m.GasLimit)))
+}
+
+// RequiredFunds 发送消息需要的余额 Value + GasFeeCap * GasLimit
+func (m *Message) RequiredFunds() BigInt {
+	return BigAdd(m.Value, m.MaxFee())
+}
+
+func (m *Message) checkGas() error {
+	if m.GasLimit <= 0 {
+		return xerrors.Errorf("gas limit must be positive, got %d", m.GasLimit)
+	}
+	if m.GasFeeCap.Int == nil || m.GasFeeCap.Sign() < 0 {
+		return xerrors.Errorf("invalid gas fee cap")
+	}
+	if m.GasPremium.Int == nil || m.GasPremium.Sign() < 0 {
+		return xerrors.Errorf("invalid gas premium")
+	}
+	return nil
+}
+
+type FeeOut struct {
+	Err                string `json:"err,omitempty"`
+	MaxFee             string `json:"max_fee,omitempty"`
+	ExpectedFee        string `json:"expected_fee,omitempty"`
+	BaseFeeBurn        string `json:"base_fee_burn,omitempty"`
+	MinerTip           string `json:"miner_tip,omitempty"`
+	OverEstimationBurn string `json:"over_estimation_burn,omitempty"`
+	MinerPenalty       string `json:"miner_penalty,omitempty"`
+	Refund             string `json:"refund,omitempty"`
+	Required           string `json:"required,omitempty"`
+	Balance            string `json:"balance,omitempty"`
+	Shortfall          string `json:"shortfall,omitempty"`
+	Sufficient         bool   `json:"sufficient"`
+}
+
+func feeOut(o *FeeOut, err error) string {
+	if err != nil {
+		o = &FeeOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// CalcFee 离线计算消息手续费
+// jsonstr 为 Msg json，baseFee 为 attoFIL，gasUsed 为空时按 GasLimit 全部用完估算
+// 输出的金额都是 FIL.Short() 格式，如 "1.234 mFIL"
+func CalcFee(jsonstr, baseFee, gasUsed string) string {
+	msg, err := parseMsg(jsonstr)
+	if err != nil {
+		return feeOut(nil, err)
+	}
+	if err := msg.checkGas(); err != nil {
+		return feeOut(nil, err)
+	}
+
+	bf, err := BigFromString(baseFee)
+	if err != nil || bf.Sign() < 0 {
+		return feeOut(nil, xerrors.Errorf("invalid base fee: %s", baseFee))
+	}
+
+	used := msg.GasLimit
+	if gasUsed != "" {
+		used, err = strconv.ParseInt(gasUsed, 10, 64)
+		if err != nil || used < 0 {
+			return feeOut(nil, xerrors.Errorf("invalid gas used: %s", gasUsed))
+		}
+		if used > msg.GasLimit {
+			return feeOut(nil, xerrors.Errorf("gas used %d exceeds gas limit %d", used, msg.GasLimit))
+		}
+	}
+
+	gas := ComputeGasOutputs(used, msg.GasLimit, bf, msg.GasFeeCap, msg.GasPremium)
+	return feeOut(&FeeOut{
+		MaxFee:             FIL(msg.MaxFee()).Short(),
+		ExpectedFee:        FIL(gas.TotalCost()).Short(),
+		BaseFeeBurn:        FIL(gas.BaseFeeBurn).Short(),
+		MinerTip:           FIL(gas.MinerTip).Short(),
+		OverEstimationBurn: FIL(gas.OverEstimationBurn).Short(),
+		MinerPenalty:       FIL(gas.MinerPenalty).Short(),
+		Refund:             FIL(gas.Refund).Short(),
+		Required:           FIL(msg.RequiredFunds()).Short(),
+	}, nil)
+}
+
+// CheckRequiredFunds 检查余额（attoFIL）是否足够支付 Value + 最大手续费
+func CheckRequiredFunds(jsonstr, balance string) string {
+	msg, err := parseMsg(jsonstr)
+	if err != nil {
+		return feeOut(nil, err)
+	}
+	if err := msg.checkGas(); err != nil {
+		return feeOut(nil, err)
+	}
+
+	b, err := BigFromString(balance)
+	if err != nil || b.Sign() < 0 {
+		return feeOut(nil, xerrors.Errorf("invalid balance: %s", balance))
+	}
+
+	required := msg.RequiredFunds()
+	o := &FeeOut{
+		MaxFee:     FIL(msg.MaxFee()).Short(),
+		Required:   FIL(required).Short(),
+		Balance:    FIL(b).Short(),
+		Sufficient: !b.LessThan(required),
+	}
+	if !o.Sufficient {
+		o.Shortfall = FIL(BigSub(required, b)).Short()
+	}
+
+	return feeOut(o, nil)
+}
@@ -0,0 +1,42 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+const feeMsg = `{"version": 0, "to": "t01000", "from": "t01001", "nonce": 1, "value": "1000000000000000000",
+	"gaslimit": 1000000, "gasfeecap": "200000", "gaspremium": "100000", "method": 0, "params": ""}`
+
+func TestCalcFee(t *testing.T) {
+	var o wlib.FeeOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.CalcFee(feeMsg, "100", "500000")), &o))
+	require.Equal(t, "", o.Err)
+	require.Equal(t, "200 nFIL", o.MaxFee)
+	require.Equal(t, "50 pFIL", o.BaseFeeBurn)
+	require.Equal(t, "45 pFIL", o.OverEstimationBurn)
+	require.Equal(t, "100 nFIL", o.MinerTip)
+	require.Equal(t, "100.095 nFIL", o.ExpectedFee)
+	require.Equal(t, "99.905 nFIL", o.Refund)
+
+	// base fee above the fee cap: the tip is squeezed out and the miner is penalised
+	require.NoError(t, json.Unmarshal([]byte(wlib.CalcFee(feeMsg, "300000", "")), &o))
+	require.Equal(t, "200 nFIL", o.ExpectedFee)
+	require.Equal(t, "0", o.MinerTip)
+	require.Equal(t, "100 nFIL", o.MinerPenalty)
+
+	require.Equal(t, 0, wlib.ComputeGasOutputs(0, 0, wlib.NewInt(1), wlib.NewInt(1), wlib.NewInt(0)).TotalCost().Sign())
+}
+
+func TestCheckRequiredFunds(t *testing.T) {
+	var o wlib.FeeOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.CheckRequiredFunds(feeMsg, "1000000000000000000")), &o))
+	require.False(t, o.Sufficient)
+	require.Equal(t, "200 nFIL", o.Shortfall)
+
+	require.NoError(t, json.Unmarshal([]byte(wlib.CheckRequiredFunds(feeMsg, "2000000000000000000")), &o))
+	require.True(t, o.Sufficient)
+}
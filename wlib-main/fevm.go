@@ -0,0 +1,137 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// MethodsEVM are the method numbers of the EVM actor. InvokeContract is
+// the FRC-42 hash of "InvokeEVM".
+var MethodsEVM = struct {
+	Constructor            abi.MethodNum
+	Resurrect              abi.MethodNum
+	GetBytecode            abi.MethodNum
+	GetBytecodeHash        abi.MethodNum
+	GetStorageAt           abi.MethodNum
+	InvokeContractDelegate abi.MethodNum
+	InvokeContract         abi.MethodNum
+}{1, 2, 3, 4, 5, 6, 3844450837}
+
+// cborBytes wraps b as a CBOR byte string, which is how the EVM actor
+// expects calldata and returns output.
+func cborBytes(b []byte) ([]byte, error) {
+	if len(b) > cbg.ByteArrayMaxLen {
+		return nil, xerrors.Errorf("byte array too long (%d)", len(b))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cbg.WriteMajorTypeHeader(buf, cbg.MajByteString, uint64(len(b))); err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	return buf.Bytes(), nil
+}
+
+func unwrapCborBytes(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	br := bytes.NewReader(b)
+	maj, extra, err := cbg.CborReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if maj != cbg.MajByteString {
+		return nil, xerrors.Errorf("expected cbor byte string, got major type %d", maj)
+	}
+	if extra != uint64(br.Len()) {
+		return nil, xerrors.Errorf("cbor byte string length %d does not match %d remaining bytes", extra, br.Len())
+	}
+
+	return b[len(b)-br.Len():], nil
+}
+
+func msgOut(msg *Msg, err error) string {
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	return jsonOut(msg)
+}
+
+func genInvokeContract(from, contract, signature, args, value string) (*Msg, error) {
+	sender, err := address.NewFromString(from)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid from address(%s): %v", from, err)
+	}
+
+	to, err := parseEthOrFilAddress(contract)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid contract address(%s): %v", contract, err)
+	}
+
+	if value == "" {
+		value = "0"
+	}
+	amount, err := ParseFIL(fmt.Sprintf("%s afil", value))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid value(%s): %v", value, err)
+	}
+
+	calldata, err := encodeABICall(signature, args)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := cborBytes(calldata)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to serialize calldata: %v", err)
+	}
+
+	return &Msg{
+		To:         to.String(),
+		From:       sender.String(),
+		Value:      amount.Int.String(),
+		GasFeeCap:  "0",
+		GasPremium: "0",
+		Method:     uint64(MethodsEVM.InvokeContract),
+		Params:     base64.StdEncoding.EncodeToString(params),
+	}, nil
+}
+
+// GenInvokeContract 构造调用 FEVM 合约的消息
+// contract 可以是 f410、f0 或 0x 地址，signature 形如 "transfer(address,uint256)"
+// args 为 json 数组（见 ABIEncodeCall），value 为 attoFIL，可为空
+// 输出 Msg json，nonce 和 gas 需要调用方填写后交给 GenCid
+func GenInvokeContract(from, contract, signature, args, value string) string {
+	return msgOut(genInvokeContract(from, contract, signature, args, value))
+}
+
+// DecodeInvokeReturn 解码 InvokeContract 回执中的 Return（base64）
+// outputs 为返回值类型，比如 "uint256" 或 "(uint256,bool)"
+// 输出 {"values": [...]}
+func DecodeInvokeReturn(outputs, ret string) string {
+	ts, err := parseABITypes(outputs)
+	if err != nil {
+		return abiOut(nil, err)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(ret)
+	if err != nil {
+		return abiOut(nil, xerrors.Errorf("invalid return data: %v", err))
+	}
+
+	data, err := unwrapCborBytes(b)
+	if err != nil {
+		return abiOut(nil, xerrors.Errorf("invalid return data: %v", err))
+	}
+
+	return abiOut(abiDecodeTuple(ts, data))
+}
@@ -2,9 +2,16 @@ package wlib
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
 type FIL BigInt
@@ -14,6 +21,9 @@ func (f FIL) String() string {
 }
 
 func (f FIL) Unitless() string {
+	if f.Int == nil {
+		return "0"
+	}
 	r := new(big.Rat).SetFrac(f.Int, big.NewInt(int64(FilecoinPrecision)))
 	if r.Sign() == 0 {
 		return "0"
@@ -24,6 +34,9 @@ func (f FIL) Unitless() string {
 var unitPrefixes = []string{"a", "f", "p", "n", "μ", "m"}
 
 func (f FIL) Short() string {
+	if f.Int == nil {
+		return "0"
+	}
 	n := BigInt(f).Abs()
 
 	dn := uint64(1)
@@ -57,55 +70,290 @@ func (f FIL) MarshalText() (text []byte, err error) {
 	return []byte(f.String()), nil
 }
 
-func (f FIL) UnmarshalText(text []byte) error {
+func (f *FIL) UnmarshalText(text []byte) error {
 	p, err := ParseFIL(string(text))
 	if err != nil {
 		return err
 	}
 
-	f.Int.Set(p.Int)
+	f.Int = p.Int
 	return nil
 }
 
-func ParseFIL(s string) (FIL, error) {
-	suffix := strings.TrimLeft(s, "-.1234567890")
-	s = s[:len(s)-len(suffix)]
-	var attofil bool
-	if suffix != "" {
-		norm := strings.ToLower(strings.TrimSpace(suffix))
-		switch norm {
-		case "", "fil":
-		case "attofil", "afil":
-			attofil = true
-		default:
-			return FIL{}, fmt.Errorf("unrecognized suffix: %q", suffix)
+// MarshalJSON 与 abi.TokenAmount 相同，输出 attoFIL 整数字符串
+func (f FIL) MarshalJSON() ([]byte, error) {
+	if f.Int == nil {
+		return []byte(`"0"`), nil
+	}
+	return json.Marshal(f.Int.String())
+}
+
+// UnmarshalJSON 接受 attoFIL 整数（字符串或数字）以及带单位的字符串，如 "1.5 FIL"
+func (f *FIL) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("invalid FIL json %s", b)
+		}
+		s = n.String()
+	}
+
+	// 没有单位（不以字母结尾）时是 attoFIL，不能有小数，可以有千位分隔符
+	s = strings.TrimSpace(s)
+	if r, _ := utf8.DecodeLastRuneInString(s); !unicode.IsLetter(r) {
+		r, err := parseDecimal(s)
+		if err != nil || !r.IsInt() {
+			return fmt.Errorf("invalid attoFIL value: %q, use a unit for FIL amounts like \"1.5 FIL\"", s)
 		}
+		f.Int = r.Num()
+		return nil
 	}
 
-	if len(s) > 50 {
-		return FIL{}, fmt.Errorf("string length too large: %d", len(s))
+	p, err := ParseFIL(s)
+	if err != nil {
+		return err
 	}
+	f.Int = p.Int
+	return nil
+}
+
+// MarshalCBOR 与 abi.TokenAmount 的编码相同
+func (f FIL) MarshalCBOR(w io.Writer) error {
+	b := BigInt(f)
+	return b.MarshalCBOR(w)
+}
+
+func (f *FIL) UnmarshalCBOR(r io.Reader) error {
+	return (*BigInt)(f).UnmarshalCBOR(r)
+}
+
+// filUnits 是 FIL 的单位，exp 为 10 的幂次（以 attoFIL 计），
+// prefixes 是 SI 前缀的写法，words 是单位的全称
+var filUnits = []struct {
+	name     string
+	exp      int
+	prefixes []string
+	words    []string
+}{
+	{"FIL", 18, []string{""}, nil},
+	{"mFIL", 15, []string{"m"}, []string{"millifil"}},
+	{"μFIL", 12, []string{"μ", "µ", "u"}, []string{"microfil"}},
+	{"nFIL", 9, []string{"n"}, []string{"nanofil"}},
+	{"pFIL", 6, []string{"p"}, []string{"picofil"}},
+	{"fFIL", 3, []string{"f"}, []string{"femtofil"}},
+	{"aFIL", 0, []string{"a"}, []string{"attofil"}},
+}
+
+// filUnitExp 返回单位的幂次。SI 前缀区分大小写（"MFIL" 不是 mFIL），
+// "fil" 和单位全称不区分大小写
+func filUnitExp(unit string) (int, bool) {
+	unit = strings.TrimSpace(unit)
+	if unit == "" {
+		return 18, true
+	}
+	for _, u := range filUnits {
+		for _, p := range u.prefixes {
+			if strings.HasPrefix(unit, p) && strings.EqualFold(unit[len(p):], "fil") {
+				return u.exp, true
+			}
+		}
+		for _, w := range u.words {
+			if strings.EqualFold(unit, w) {
+				return u.exp, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// maxFILExponent 限制科学计数法的指数，避免构造巨大的数
+const maxFILExponent = 40
+
+// parseDecimal 解析十进制数，支持科学计数法和千位分隔符（"," 或 "_"）
+func parseDecimal(s string) (*big.Rat, error) {
+	mant, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mant, exp = s[:i], s[i+1:]
+		e, err := strconv.Atoi(exp)
+		if err != nil || e > maxFILExponent || e < -maxFILExponent {
+			return nil, fmt.Errorf("invalid exponent in %q", s)
+		}
+	}
+
+	if strings.ContainsAny(mant, ",_") {
+		intPart, frac := mant, ""
+		if i := strings.Index(mant, "."); i >= 0 {
+			intPart, frac = mant[:i], mant[i:]
+		}
+		if strings.ContainsAny(frac, ",_") {
+			return nil, fmt.Errorf("misplaced thousands separator in %q", s)
+		}
+		groups := strings.FieldsFunc(strings.TrimLeft(intPart, "+-"), func(r rune) bool { return r == ',' || r == '_' })
+		if len(groups) == 0 || len(groups[0]) > 3 || strings.Count(intPart, ",")+strings.Count(intPart, "_") != len(groups)-1 {
+			return nil, fmt.Errorf("misplaced thousands separator in %q", s)
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return nil, fmt.Errorf("misplaced thousands separator in %q", s)
+			}
+		}
+		mant = strings.NewReplacer(",", "", "_", "").Replace(mant)
+	}
+
+	if exp != "" {
+		mant += "e" + exp
+	}
+	r, ok := new(big.Rat).SetString(mant)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse %q as a decimal number", s)
+	}
+	return r, nil
+}
 
-	r, ok := new(big.Rat).SetString(s)
+// ParseFIL 解析带单位的数额，如 "1.5 FIL"、"200 nFIL"、"1,000 FIL"、"1.5e-3 FIL"，
+// 单位可以是 FIL、mFIL、μFIL（uFIL）、nFIL、pFIL、fFIL、aFIL（attoFIL），
+// SI 前缀区分大小写，"fil" 不区分大小写，没有单位时为 FIL
+func ParseFIL(s string) (FIL, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, unicode.IsLetter)
+	suffix := s[len(num):]
+	num = strings.TrimSpace(num)
+
+	exp, ok := filUnitExp(suffix)
 	if !ok {
-		return FIL{}, fmt.Errorf("failed to parse %q as a decimal number", s)
+		return FIL{}, fmt.Errorf("unrecognized suffix: %q", suffix)
+	}
+
+	if len(num) > 50 {
+		return FIL{}, fmt.Errorf("string length too large: %d", len(num))
 	}
 
-	if !attofil {
-		r = r.Mul(r, big.NewRat(int64(FilecoinPrecision), 1))
+	r, err := parseDecimal(num)
+	if err != nil {
+		return FIL{}, err
 	}
+	r = r.Mul(r, new(big.Rat).SetInt(pow10(exp)))
 
 	if !r.IsInt() {
-		var pref string
-		if attofil {
-			pref = "atto"
-		}
-		return FIL{}, fmt.Errorf("invalid %sFIL value: %q", pref, s)
+		return FIL{}, fmt.Errorf("invalid %s value: %q, more than 18 decimals of FIL", unitName(exp), num)
 	}
 
 	return FIL{r.Num()}, nil
 }
 
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func unitName(exp int) string {
+	for _, u := range filUnits {
+		if u.exp == exp {
+			return u.name
+		}
+	}
+	return "FIL"
+}
+
+// RoundingMode 格式化时舍入的方式
+type RoundingMode int
+
+const (
+	// RoundHalfEven 四舍六入五成双
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp 四舍五入（远离零）
+	RoundHalfUp
+	// RoundDown 截断（趋向零）
+	RoundDown
+	// RoundUp 进位（远离零）
+	RoundUp
+)
+
+// roundQuo 计算 |n| / den 并按 mode 舍入到整数
+func roundQuo(n, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(n), den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	var up bool
+	switch mode {
+	case RoundUp:
+		up = true
+	case RoundHalfUp, RoundHalfEven:
+		c := new(big.Int).Lsh(r, 1).Cmp(den)
+		up = c > 0 || (c == 0 && (mode == RoundHalfUp || q.Bit(0) == 1))
+	}
+	if up {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// autoUnit 与 Short 的选择相同：使整数部分小于 1000 的最大单位
+func autoUnit(n *big.Int) int {
+	abs := new(big.Int).Abs(n)
+	for exp := 0; exp < 18; exp += 3 {
+		if abs.Cmp(pow10(exp+3)) < 0 {
+			return exp
+		}
+	}
+	return 18
+}
+
+// FormatFIL 按单位格式化，结果可以被 ParseFIL 解析。
+// unit 为空时自动选择单位（同 Short）；decimals < 0 时保留全部有效小数，
+// 否则按 mode 舍入到 decimals 位，不足时补零
+func FormatFIL(f FIL, unit string, decimals int, mode RoundingMode) (string, error) {
+	n := f.Int
+	if n == nil {
+		n = new(big.Int)
+	}
+
+	exp := autoUnit(n)
+	if unit != "" {
+		var ok bool
+		if exp, ok = filUnitExp(unit); !ok {
+			return "", fmt.Errorf("unknown unit %q", unit)
+		}
+	}
+
+	return formatScaled(n, exp, decimals, mode) + " " + unitName(exp), nil
+}
+
+// formatScaled 把 n / 10^exp 格式化为十进制数，decimals 与 mode 同 FormatFIL
+func formatScaled(n *big.Int, exp, decimals int, mode RoundingMode) string {
+	d := decimals
+	if d < 0 {
+		d = exp
+	}
+	var q *big.Int
+	if d >= exp {
+		q = new(big.Int).Mul(new(big.Int).Abs(n), pow10(d-exp))
+	} else {
+		q = roundQuo(n, pow10(exp-d), mode)
+	}
+	return decimalString(q, n.Sign() < 0, d, decimals < 0)
+}
+
+// decimalString 在 q 的倒数第 d 位前插入小数点，trim 时去掉末尾的零
+func decimalString(q *big.Int, neg bool, d int, trim bool) string {
+	digits := q.String()
+	if d > 0 {
+		if len(digits) <= d {
+			digits = strings.Repeat("0", d-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d] + "." + digits[len(digits)-d:]
+		if trim {
+			digits = strings.TrimRight(strings.TrimRight(digits, "0"), ".")
+		}
+	}
+	if neg && q.Sign() != 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
+
 func MustParseFIL(s string) FIL {
 	n, err := ParseFIL(s)
 	if err != nil {
@@ -117,3 +365,7 @@ func MustParseFIL(s string) FIL {
 
 var _ encoding.TextMarshaler = (*FIL)(nil)
 var _ encoding.TextUnmarshaler = (*FIL)(nil)
+var _ json.Marshaler = (*FIL)(nil)
+var _ json.Unmarshaler = (*FIL)(nil)
+var _ cbg.CBORMarshaler = (*FIL)(nil)
+var _ cbg.CBORUnmarshaler = (*FIL)(nil)
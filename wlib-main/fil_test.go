@@ -0,0 +1,161 @@
+package wlib_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestFILUnmarshalText(t *testing.T) {
+	var f wlib.FIL
+	require.NoError(t, f.UnmarshalText([]byte("1.5 FIL")))
+	require.Equal(t, "1500000000000000000", f.Int.String())
+
+	text, err := f.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "1.5 FIL", string(text))
+
+	require.Error(t, f.UnmarshalText([]byte("1.5 BTC")))
+	require.Equal(t, "0 FIL", wlib.FIL{}.String())
+}
+
+func TestFILJSON(t *testing.T) {
+	type config struct {
+		Limit wlib.FIL
+		Fee   wlib.FIL
+		Zero  wlib.FIL
+	}
+
+	var c config
+	require.NoError(t, json.Unmarshal([]byte(`{"Limit": "1.5 FIL", "Fee": "1000", "Zero": 0}`), &c))
+	require.Equal(t, "1500000000000000000", c.Limit.Int.String())
+	require.Equal(t, "1000", c.Fee.Int.String())
+	require.Equal(t, "0", c.Zero.Int.String())
+
+	b, err := json.Marshal(&c)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Limit": "1500000000000000000", "Fee": "1000", "Zero": "0"}`, string(b))
+
+	var back config
+	require.NoError(t, json.Unmarshal(b, &back))
+	require.Equal(t, c, back)
+
+	// the JSON encoding is interchangeable with abi.TokenAmount
+	ta, err := json.Marshal(abi.TokenAmount(c.Limit))
+	require.NoError(t, err)
+	require.JSONEq(t, `"1500000000000000000"`, string(ta))
+
+	require.Error(t, json.Unmarshal([]byte(`{"Limit": "1.5"}`), &c))
+	require.Error(t, json.Unmarshal([]byte(`{"Limit": true}`), &c))
+
+	// separators do not turn a unitless amount into FIL
+	require.NoError(t, json.Unmarshal([]byte(`{"Limit": "1,000", "Fee": "2_000_000"}`), &c))
+	require.Equal(t, "1000", c.Limit.Int.String())
+	require.Equal(t, "2000000", c.Fee.Int.String())
+	require.Error(t, json.Unmarshal([]byte(`{"Limit": "1,000.5"}`), &c))
+	require.Error(t, json.Unmarshal([]byte(`{"Limit": "10,00"}`), &c))
+}
+
+func TestFILCBOR(t *testing.T) {
+	f := wlib.MustParseFIL("-2.25")
+
+	var fb, tb bytes.Buffer
+	require.NoError(t, f.MarshalCBOR(&fb))
+	ta := abi.TokenAmount(f)
+	require.NoError(t, ta.MarshalCBOR(&tb))
+	require.Equal(t, tb.Bytes(), fb.Bytes())
+
+	var back wlib.FIL
+	require.NoError(t, back.UnmarshalCBOR(bytes.NewReader(fb.Bytes())))
+	require.Equal(t, f.Int.String(), back.Int.String())
+
+	var zero bytes.Buffer
+	require.NoError(t, wlib.FIL{}.MarshalCBOR(&zero))
+	require.NoError(t, back.UnmarshalCBOR(&zero))
+	require.Equal(t, "0", back.Int.String())
+}
+
+func TestParseFILUnits(t *testing.T) {
+	for in, want := range map[string]string{
+		"1.5":            "1500000000000000000",
+		"1.5 FIL":        "1500000000000000000",
+		"2 mFIL":         "2000000000000000",
+		"3 μFIL":         "3000000000000",
+		"3 uFIL":         "3000000000000",
+		"4 nfil":         "4000000000",
+		"5 pFIL":         "5000000",
+		"6 fFIL":         "6000",
+		"7 aFIL":         "7",
+		"7 attofil":      "7",
+		"7 AttoFIL":      "7",
+		"8 µfil":         "8000000000000",
+		"1.5e-3 FIL":     "1500000000000000",
+		"2E2 nFIL":       "200000000000",
+		"1,000.5 FIL":    "1000500000000000000000",
+		"-1_000 aFIL":    "-1000",
+		"12,345,678aFIL": "12345678",
+	} {
+		f, err := wlib.ParseFIL(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, f.Int.String(), in)
+	}
+
+	for _, in := range []string{"1.5 aFIL", "1 kFIL", "1 MFIL", "1 PFIL", "1 NFIL", "1 UFIL", "1,5 FIL", "1,0000 FIL", "1.000,5 FIL", "1e100 FIL", "abc"} {
+		_, err := wlib.ParseFIL(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestFormatFIL(t *testing.T) {
+	f := wlib.MustParseFIL("1.23456789 FIL")
+	for _, c := range []struct {
+		unit     string
+		decimals int
+		mode     wlib.RoundingMode
+		want     string
+	}{
+		{"", -1, wlib.RoundHalfEven, "1.23456789 FIL"},
+		{"FIL", 2, wlib.RoundHalfEven, "1.23 FIL"},
+		{"FIL", 4, wlib.RoundHalfUp, "1.2346 FIL"},
+		{"FIL", 4, wlib.RoundDown, "1.2345 FIL"},
+		{"FIL", 1, wlib.RoundUp, "1.3 FIL"},
+		{"FIL", 10, wlib.RoundDown, "1.2345678900 FIL"},
+		{"mFIL", 0, wlib.RoundHalfEven, "1235 mFIL"},
+		{"nFIL", -1, wlib.RoundHalfEven, "1234567890 nFIL"},
+	} {
+		s, err := wlib.FormatFIL(f, c.unit, c.decimals, c.mode)
+		require.NoError(t, err)
+		require.Equal(t, c.want, s)
+	}
+
+	// half even vs half up on an exact tie
+	half := wlib.MustParseFIL("2.5 mFIL")
+	s, _ := wlib.FormatFIL(half, "mFIL", 0, wlib.RoundHalfEven)
+	require.Equal(t, "2 mFIL", s)
+	s, _ = wlib.FormatFIL(half, "mFIL", 0, wlib.RoundHalfUp)
+	require.Equal(t, "3 mFIL", s)
+
+	_, err := wlib.FormatFIL(f, "kFIL", 0, wlib.RoundDown)
+	require.Error(t, err)
+
+	// everything displayed can be parsed back
+	for _, v := range []string{"0", "-0.0000042 FIL", "999 aFIL", "1000 aFIL", "12.5 μFIL", "123456.789 FIL"} {
+		f := wlib.MustParseFIL(v)
+		for _, s := range []string{f.String(), f.Short()} {
+			back, err := wlib.ParseFIL(s)
+			require.NoError(t, err, s)
+			if s == f.String() {
+				require.Equal(t, f.Int.String(), back.Int.String(), s)
+			}
+		}
+		s, err := wlib.FormatFIL(f, "", -1, wlib.RoundHalfEven)
+		require.NoError(t, err)
+		back, err := wlib.ParseFIL(s)
+		require.NoError(t, err, s)
+		require.Equal(t, f.Int.String(), back.Int.String(), s)
+	}
+}
@@ -0,0 +1,171 @@
+package wlib
+
+import (
+	"math/big"
+	"sort"
+
+	"golang.org/x/xerrors"
+)
+
+// FIL 的精确运算。与 BigAdd 等不同，结果必须在 [0, TotalFilecoinInt] 内，
+// 除法按指定的方式舍入，拆分时余数分配给前面的份额，总和与原数额完全相等
+
+var (
+	ErrNegativeFIL = xerrors.New("negative FIL amount")
+	ErrFILOverflow = xerrors.New("FIL amount exceeds the total supply")
+)
+
+func (f FIL) bigInt() *big.Int {
+	if f.Int == nil {
+		return new(big.Int)
+	}
+	return f.Int
+}
+
+// Check 检查数额在 [0, TotalFilecoinInt] 内
+func (f FIL) Check() error {
+	n := f.bigInt()
+	if n.Sign() < 0 {
+		return xerrors.Errorf("%s: %w", FIL{n}, ErrNegativeFIL)
+	}
+	if n.Cmp(TotalFilecoinInt.Int) > 0 {
+		return xerrors.Errorf("%s: %w", FIL{n}, ErrFILOverflow)
+	}
+	return nil
+}
+
+func checkedFIL(n *big.Int) (FIL, error) {
+	f := FIL{n}
+	if err := f.Check(); err != nil {
+		return FIL{}, err
+	}
+	return f, nil
+}
+
+func checkOperands(fs ...FIL) error {
+	for _, f := range fs {
+		if err := f.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f FIL) Add(g FIL) (FIL, error) {
+	if err := checkOperands(f, g); err != nil {
+		return FIL{}, err
+	}
+	return checkedFIL(new(big.Int).Add(f.bigInt(), g.bigInt()))
+}
+
+// Sub 结果为负时返回 ErrNegativeFIL
+func (f FIL) Sub(g FIL) (FIL, error) {
+	if err := checkOperands(f, g); err != nil {
+		return FIL{}, err
+	}
+	n := new(big.Int).Sub(f.bigInt(), g.bigInt())
+	if n.Sign() < 0 {
+		return FIL{}, xerrors.Errorf("%s - %s: %w", f, g, ErrNegativeFIL)
+	}
+	return FIL{n}, nil
+}
+
+// MulRat 乘以非负有理数，按 mode 舍入到 attoFIL
+func (f FIL) MulRat(r *big.Rat, mode RoundingMode) (FIL, error) {
+	if err := f.Check(); err != nil {
+		return FIL{}, err
+	}
+	if r.Sign() < 0 {
+		return FIL{}, xerrors.Errorf("negative multiplier %s: %w", r.RatString(), ErrNegativeFIL)
+	}
+	num := new(big.Int).Mul(f.bigInt(), r.Num())
+	return checkedFIL(roundQuo(num, r.Denom(), mode))
+}
+
+// Percent 计算 pct%，如 big.NewRat(25, 10) 为 2.5%
+func (f FIL) Percent(pct *big.Rat, mode RoundingMode) (FIL, error) {
+	return f.MulRat(new(big.Rat).Quo(pct, big.NewRat(100, 1)), mode)
+}
+
+// DivMod 平分为 n 份，返回每份的数额和余数
+func (f FIL) DivMod(n int) (FIL, FIL, error) {
+	if err := f.Check(); err != nil {
+		return FIL{}, FIL{}, err
+	}
+	if n <= 0 {
+		return FIL{}, FIL{}, xerrors.Errorf("invalid number of shares %d", n)
+	}
+	q, r := new(big.Int).QuoRem(f.bigInt(), big.NewInt(int64(n)), new(big.Int))
+	return FIL{q}, FIL{r}, nil
+}
+
+// SplitEvenly 平分为 n 份，余数的 attoFIL 逐个分给前面的份额，
+// 各份之和等于 f，最大与最小的份额相差不超过 1 attoFIL
+func (f FIL) SplitEvenly(n int) ([]FIL, error) {
+	q, r, err := f.DivMod(n)
+	if err != nil {
+		return nil, err
+	}
+
+	rem := int(r.Int64())
+	shares := make([]FIL, n)
+	for i := range shares {
+		s := new(big.Int).Set(q.Int)
+		if i < rem {
+			s.Add(s, big.NewInt(1))
+		}
+		shares[i] = FIL{s}
+	}
+	return shares, nil
+}
+
+// SplitByWeights 按权重分配，先按比例向下取整，剩余的 attoFIL 按最大余数法
+// 分配（余数相同时靠前的优先），各份之和等于 f
+func (f FIL) SplitByWeights(weights []uint64) ([]FIL, error) {
+	if err := f.Check(); err != nil {
+		return nil, err
+	}
+
+	total := new(big.Int)
+	for _, w := range weights {
+		total.Add(total, new(big.Int).SetUint64(w))
+	}
+	if total.Sign() == 0 {
+		return nil, xerrors.Errorf("weights must not all be zero")
+	}
+
+	shares := make([]FIL, len(weights))
+	rems := make([]*big.Int, len(weights))
+	left := new(big.Int).Set(f.bigInt())
+	for i, w := range weights {
+		num := new(big.Int).Mul(f.bigInt(), new(big.Int).SetUint64(w))
+		q, r := new(big.Int).QuoRem(num, total, new(big.Int))
+		shares[i], rems[i] = FIL{q}, r
+		left.Sub(left, q)
+	}
+
+	// left < len(weights)
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return rems[order[a]].Cmp(rems[order[b]]) > 0
+	})
+	for _, i := range order[:left.Int64()] {
+		shares[i].Int.Add(shares[i].Int, big.NewInt(1))
+	}
+	return shares, nil
+}
+
+// SumFIL 求和，任一数额或结果超出范围时返回错误
+func SumFIL(fs ...FIL) (FIL, error) {
+	sum := FIL{new(big.Int)}
+	for _, f := range fs {
+		var err error
+		if sum, err = sum.Add(f); err != nil {
+			return FIL{}, err
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,85 @@
+package wlib_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestFILArithmetic(t *testing.T) {
+	a, b := wlib.MustParseFIL("1.5"), wlib.MustParseFIL("0.25")
+
+	sum, err := a.Add(b)
+	require.NoError(t, err)
+	require.Equal(t, "1.75 FIL", sum.String())
+
+	diff, err := a.Sub(b)
+	require.NoError(t, err)
+	require.Equal(t, "1.25 FIL", diff.String())
+
+	_, err = b.Sub(a)
+	require.True(t, xerrors.Is(err, wlib.ErrNegativeFIL))
+	_, err = wlib.FIL(wlib.TotalFilecoinInt).Add(wlib.MustParseFIL("1 aFIL"))
+	require.True(t, xerrors.Is(err, wlib.ErrFILOverflow))
+	_, err = wlib.MustParseFIL("-1").Add(a)
+	require.True(t, xerrors.Is(err, wlib.ErrNegativeFIL))
+
+	third, err := wlib.MustParseFIL("1 aFIL").MulRat(big.NewRat(1, 3), wlib.RoundHalfEven)
+	require.NoError(t, err)
+	require.Equal(t, "0", third.Int.String())
+	up, err := wlib.MustParseFIL("1 aFIL").MulRat(big.NewRat(1, 3), wlib.RoundUp)
+	require.NoError(t, err)
+	require.Equal(t, "1", up.Int.String())
+
+	fee, err := wlib.MustParseFIL("10").Percent(big.NewRat(25, 10), wlib.RoundDown)
+	require.NoError(t, err)
+	require.Equal(t, "0.25 FIL", fee.String())
+}
+
+func TestFILSplit(t *testing.T) {
+	reward := wlib.MustParseFIL("10 aFIL")
+
+	q, r, err := reward.DivMod(3)
+	require.NoError(t, err)
+	require.Equal(t, "3", q.Int.String())
+	require.Equal(t, "1", r.Int.String())
+
+	shares, err := reward.SplitEvenly(3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"4", "3", "3"}, amounts(shares))
+
+	_, err = reward.SplitEvenly(0)
+	require.Error(t, err)
+
+	// 10 * [1, 1, 1, 2] / 5 = [2, 2, 2, 4]
+	// 10 * [3, 3, 1] / 7 = [4.29, 4.29, 1.43], the largest remainder gets the spare attoFIL
+	shares, err = reward.SplitByWeights([]uint64{1, 1, 1, 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"2", "2", "2", "4"}, amounts(shares))
+	shares, err = reward.SplitByWeights([]uint64{3, 3, 1})
+	require.NoError(t, err)
+	require.Equal(t, []string{"4", "4", "2"}, amounts(shares))
+
+	// no attoFIL is lost or invented
+	amount := wlib.MustParseFIL("123.456789012345678901")
+	shares, err = amount.SplitByWeights([]uint64{7, 0, 13, 29, 1})
+	require.NoError(t, err)
+	total, err := wlib.SumFIL(shares...)
+	require.NoError(t, err)
+	require.Equal(t, amount.Int.String(), total.Int.String())
+
+	_, err = amount.SplitByWeights([]uint64{0, 0})
+	require.Error(t, err)
+}
+
+func amounts(fs []wlib.FIL) []string {
+	var out []string
+	for _, f := range fs {
+		out = append(out, f.Int.String())
+	}
+	return out
+}
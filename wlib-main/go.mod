@@ -3,7 +3,7 @@ module gitlab.forceup.in/FilecoinWallet/FilWallet/wlib
 go 1.16
 
 require (
-	github.com/filecoin-project/go-address v0.0.5
+	github.com/filecoin-project/go-address v1.1.0
 	github.com/filecoin-project/go-crypto v0.0.0-20191218222705-effae4ea9f03
 	github.com/filecoin-project/go-state-types v0.1.1-0.20210506134452-99b279731c48
 	github.com/filecoin-project/specs-actors v0.9.13
@@ -15,7 +15,9 @@ require (
 	github.com/smartystreets/assertions v1.0.1
 	github.com/stretchr/testify v1.7.0
 	github.com/whyrusleeping/cbor-gen v0.0.0-20210422071115-ad5b82622e0f
+	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 	golang.org/x/mobile v0.0.0-20210614202936-7c8f154d1008 // indirect
 	golang.org/x/tools v0.1.2 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
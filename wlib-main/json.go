@@ -177,6 +177,16 @@ func genOut(param []byte, err error) string {
 	return string(result)
 }
 
+// jsonOut 把输出结构编码为 json，失败时按 genOut 的格式返回错误
+func jsonOut(v interface{}) string {
+	result, err := json.Marshal(v)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	return string(result)
+}
+
 func SerializeParams(i cbg.CBORMarshaler) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := i.MarshalCBOR(buf); err != nil {
@@ -0,0 +1,238 @@
+package wlib
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// Locale 是数字的小数点和千位分隔符
+type Locale struct {
+	Tag     string
+	Decimal string
+	Group   string
+}
+
+// locales 中法语用窄空格分组，其余用空格分组的语言用不换行空格，瑞士德语用撇号
+var locales = map[string]Locale{
+	"en":    {"en", ".", ","},
+	"zh":    {"zh", ".", ","},
+	"ja":    {"ja", ".", ","},
+	"ko":    {"ko", ".", ","},
+	"de":    {"de", ",", "."},
+	"es":    {"es", ",", "."},
+	"it":    {"it", ",", "."},
+	"nl":    {"nl", ",", "."},
+	"pt":    {"pt", ",", "."},
+	"tr":    {"tr", ",", "."},
+	"id":    {"id", ",", "."},
+	"da":    {"da", ",", "."},
+	"fr":    {"fr", ",", "\u202f"},
+	"ru":    {"ru", ",", "\u00a0"},
+	"uk":    {"uk", ",", "\u00a0"},
+	"pl":    {"pl", ",", "\u00a0"},
+	"cs":    {"cs", ",", "\u00a0"},
+	"sv":    {"sv", ",", "\u00a0"},
+	"fi":    {"fi", ",", "\u00a0"},
+	"nb":    {"nb", ",", "\u00a0"},
+	"de-ch": {"de-CH", ".", "\u2019"},
+}
+
+// LookupLocale 按 BCP 47 标签查找，如 "zh-CN"、"de_DE"、"fr"，先匹配
+// 语言加地区，再匹配语言。找不到时返回 en 和 false
+func LookupLocale(tag string) (Locale, bool) {
+	norm := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	parts := strings.Split(norm, "-")
+	if len(parts) >= 2 {
+		if l, ok := locales[parts[0]+"-"+parts[len(parts)-1]]; ok {
+			return l, true
+		}
+	}
+	if l, ok := locales[parts[0]]; ok {
+		return l, true
+	}
+	return locales["en"], false
+}
+
+// localize 把 "-1234567.89" 转为本地格式
+func (l Locale) localize(num string) string {
+	neg := strings.HasPrefix(num, "-")
+	num = strings.TrimPrefix(num, "-")
+
+	intPart, frac := num, ""
+	if i := strings.Index(num, "."); i >= 0 {
+		intPart, frac = num[:i], num[i+1:]
+	}
+
+	var sb strings.Builder
+	if neg {
+		sb.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(l.Group)
+		}
+		sb.WriteRune(c)
+	}
+	if frac != "" {
+		sb.WriteString(l.Decimal)
+		sb.WriteString(frac)
+	}
+	return sb.String()
+}
+
+// FormatFIL 同 wlib.FormatFIL，使用本地的分隔符
+func (l Locale) FormatFIL(f FIL, unit string, decimals int, mode RoundingMode) (string, error) {
+	s, err := FormatFIL(f, unit, decimals, mode)
+	if err != nil {
+		return "", err
+	}
+	i := strings.LastIndex(s, " ")
+	return l.localize(s[:i]) + s[i:], nil
+}
+
+// FormatFiat 按汇率 rate（每 FIL 的法币价格）换算并格式化，保留 decimals 位小数
+func (l Locale) FormatFiat(f FIL, rate *big.Rat, currency string, decimals int, mode RoundingMode) string {
+	n := f.Int
+	if n == nil {
+		n = new(big.Int)
+	}
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	// n * rate * 10^decimals / 10^18
+	num := new(big.Int).Mul(n, rate.Num())
+	num.Mul(num, pow10(decimals))
+	den := new(big.Int).Mul(rate.Denom(), pow10(18))
+	q := roundQuo(num, den, mode)
+
+	s := l.localize(decimalString(q, num.Sign() < 0, decimals, false))
+	if currency != "" {
+		s += " " + currency
+	}
+	return s
+}
+
+// currencyDecimals 是 ISO 4217 中小数位数不是 2 的货币
+var currencyDecimals = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "PYG": 0, "UGX": 0, "XAF": 0, "XOF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyDecimals 返回货币的小数位数，如 JPY 为 0、KWD 为 3，其余为 2
+func CurrencyDecimals(currency string) int {
+	if d, ok := currencyDecimals[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return d
+	}
+	return 2
+}
+
+// ParseFIL 解析本地格式的数额，如 de 的 "1.234,5 FIL"。千位分隔符的位置
+// 必须正确，避免把 de 的 "1.5" 当作 1.5
+func (l Locale) ParseFIL(s string) (FIL, error) {
+	s = strings.TrimSpace(s)
+	groups := []string{l.Group}
+	if isSpaceGroup(l.Group) {
+		// 窄空格、不换行空格和普通空格都接受
+		groups = []string{"\u202f", "\u00a0", " "}
+	}
+	for _, g := range groups {
+		s = replaceGroup(s, g)
+	}
+	if l.Decimal != "." {
+		if strings.Contains(s, ".") {
+			return FIL{}, fmt.Errorf("invalid number %q for locale %s", s, l.Tag)
+		}
+		s = strings.Replace(s, l.Decimal, ".", 1)
+	}
+	return ParseFIL(s)
+}
+
+func isSpaceGroup(g string) bool {
+	r, _ := utf8.DecodeRuneInString(g)
+	return r == ' ' || r == '\u00a0' || r == '\u202f'
+}
+
+// replaceGroup 把数字之间的分组符替换为 "_"，数字与单位之间的空格保留
+func replaceGroup(s, g string) string {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, g)
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		rest := s[i+len(g):]
+		sb.WriteString(s[:i])
+		if i > 0 && isDigit(s[i-1]) && rest != "" && isDigit(rest[0]) {
+			sb.WriteByte('_')
+		} else {
+			sb.WriteString(g)
+		}
+		s = rest
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// LocaleOut 是 FormatFILLocale 和 ParseFILLocale 的输出
+type LocaleOut struct {
+	Err    string `json:"err,omitempty"`
+	Locale string `json:"locale,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Fiat   string `json:"fiat,omitempty"`
+	// Value 单位 attoFIL
+	Value string `json:"value,omitempty"`
+}
+
+func localeOut(o *LocaleOut, err error) string {
+	if err != nil {
+		o = &LocaleOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// FormatFILLocale 按语言格式化数额，value 单位 attoFIL，unit 为空时自动选择，
+// decimals < 0 时保留全部小数。rate 不为空时按汇率（每 FIL 的价格，十进制字符串，
+// 如 "4.25"）换算为 currency，小数位数见 CurrencyDecimals，四舍六入五成双
+// 输出 {"locale": "de", "text": "1.234,5 FIL", "fiat": "5.246,62 EUR", "value": "1234500000000000000000"}
+func FormatFILLocale(value, locale, unit string, decimals int, rate, currency string) string {
+	v, err := BigFromString(value)
+	if err != nil {
+		return localeOut(nil, xerrors.Errorf("invalid value(%s): %v", value, err))
+	}
+	l, _ := LookupLocale(locale)
+
+	text, err := l.FormatFIL(FIL(v), unit, decimals, RoundHalfEven)
+	if err != nil {
+		return localeOut(nil, err)
+	}
+	o := &LocaleOut{Locale: l.Tag, Text: text, Value: v.String()}
+
+	if rate != "" {
+		r, err := parseDecimal(rate)
+		if err != nil || r.Sign() < 0 {
+			return localeOut(nil, xerrors.Errorf("invalid rate(%s): %v", rate, err))
+		}
+		o.Fiat = l.FormatFiat(FIL(v), r, currency, CurrencyDecimals(currency), RoundHalfEven)
+	}
+	return localeOut(o, nil)
+}
+
+// ParseFILLocale 解析用户按语言习惯输入的数额
+// 输出 {"locale": "de", "text": "1234.5 FIL", "value": "1234500000000000000000"}
+func ParseFILLocale(s, locale string) string {
+	l, _ := LookupLocale(locale)
+	f, err := l.ParseFIL(s)
+	if err != nil {
+		return localeOut(nil, err)
+	}
+	return localeOut(&LocaleOut{Locale: l.Tag, Text: f.String(), Value: f.Int.String()}, nil)
+}
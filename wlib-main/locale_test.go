@@ -0,0 +1,71 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestLocaleFormat(t *testing.T) {
+	f := wlib.MustParseFIL("1234567.891 FIL")
+	for tag, want := range map[string]string{
+		"en-US": "1,234,567.891 FIL",
+		"zh_CN": "1,234,567.891 FIL",
+		"de-DE": "1.234.567,891 FIL",
+		"fr":    "1 234 567,891 FIL",
+		"ru-RU": "1 234 567,891 FIL",
+		"de-CH": "1’234’567.891 FIL",
+		"xx":    "1,234,567.891 FIL",
+	} {
+		l, _ := wlib.LookupLocale(tag)
+		s, err := l.FormatFIL(f, "", -1, wlib.RoundHalfEven)
+		require.NoError(t, err)
+		require.Equal(t, want, s, tag)
+
+		back, err := l.ParseFIL(s)
+		require.NoError(t, err, tag)
+		require.Equal(t, f.Int.String(), back.Int.String(), tag)
+	}
+
+	de, ok := wlib.LookupLocale("de-AT")
+	require.True(t, ok)
+	s := de.FormatFiat(f, big.NewRat(425, 100), "EUR", 2, wlib.RoundHalfEven)
+	require.Equal(t, "5.246.913,54 EUR", s)
+
+	// "1.5" is fifteen hundred-ish in German, reject rather than guess
+	_, err := de.ParseFIL("1.5 FIL")
+	require.Error(t, err)
+	fr, _ := wlib.LookupLocale("fr-FR")
+	v, err := fr.ParseFIL("1 000,5 mFIL")
+	require.NoError(t, err)
+	require.Equal(t, "1000500000000000000", v.Int.String())
+}
+
+func TestFormatFILLocale(t *testing.T) {
+	var out wlib.LocaleOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.FormatFILLocale("1234500000000000000000", "de", "FIL", 2, "4.25", "EUR")), &out))
+	require.Empty(t, out.Err)
+	require.Equal(t, "1.234,50 FIL", out.Text)
+	require.Equal(t, "5.246,62 EUR", out.Fiat)
+
+	require.NoError(t, json.Unmarshal([]byte(wlib.ParseFILLocale(out.Text, "de")), &out))
+	require.Empty(t, out.Err)
+	require.Equal(t, "1234500000000000000000", out.Value)
+
+	require.Contains(t, wlib.FormatFILLocale("1", "de", "", -1, "abc", "EUR"), "invalid rate")
+
+	// fiat uses the minor unit of the currency
+	for _, c := range []struct{ locale, currency, fiat string }{
+		{"ja", "JPY", "5,247 JPY"},
+		{"ko", "krw", "5,247 krw"},
+		{"en", "KWD", "5,246.625 KWD"},
+		{"en", "USD", "5,246.62 USD"},
+	} {
+		require.NoError(t, json.Unmarshal([]byte(wlib.FormatFILLocale("1234500000000000000000", c.locale, "FIL", 2, "4.25", c.currency)), &out))
+		require.Empty(t, out.Err)
+		require.Equal(t, c.fiat, out.Fiat, c.currency)
+	}
+}
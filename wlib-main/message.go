@@ -12,8 +12,13 @@ import (
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
 )
 
+// SigTypeDelegated is used by f4 accounts, for example Ethereum style
+// transactions signed over their RLP encoding. go-state-types predates it.
+const SigTypeDelegated = crypto.SigType(3)
+
 type Message struct {
 	Version uint64
 
@@ -63,6 +68,112 @@ func (m *Message) Cid() cid.Cid {
 	return c
 }
 
+type SignedMessage struct {
+	Message   Message
+	Signature crypto.Signature
+}
+
+func (sm *SignedMessage) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := sm.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Cid of a BLS signed message is the CID of the unsigned message, since BLS
+// signatures are aggregated in the block.
+func (sm *SignedMessage) Cid() cid.Cid {
+	if sm.Signature.Type == crypto.SigTypeBLS {
+		return sm.Message.Cid()
+	}
+
+	data, err := sm.Serialize()
+	if err != nil {
+		return cid.Cid{}
+	}
+
+	pref := cid.NewPrefixV1(cid.DagCBOR, multihash.BLAKE2B_MIN+31)
+	c, err := pref.Sum(data)
+	if err != nil {
+		return cid.Cid{}
+	}
+	return c
+}
+
+var lengthBufSignedMessage = []byte{130}
+
+func (t *SignedMessage) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufSignedMessage); err != nil {
+		return err
+	}
+
+	// t.Message (types.Message) (struct)
+	if err := t.Message.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.Signature (crypto.Signature) (struct)
+	if err := t.Signature.MarshalCBOR(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *SignedMessage) UnmarshalCBOR(r io.Reader) error {
+	*t = SignedMessage{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 2 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Message (types.Message) (struct)
+
+	{
+
+		if err := t.Message.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.Message: %w", err)
+		}
+
+	}
+	// t.Signature (crypto.Signature) (struct)
+
+	{
+
+		// crypto.Signature.UnmarshalCBOR rejects SigTypeDelegated
+		sig, err := cbg.ReadByteArray(br, crypto.SignatureMaxLength)
+		if err != nil {
+			return xerrors.Errorf("unmarshaling t.Signature: %w", err)
+		}
+		if len(sig) == 0 {
+			return fmt.Errorf("unmarshaling t.Signature: empty signature")
+		}
+		switch crypto.SigType(sig[0]) {
+		case crypto.SigTypeSecp256k1, crypto.SigTypeBLS, SigTypeDelegated:
+		default:
+			return fmt.Errorf("invalid signature type in cbor input: %d", sig[0])
+		}
+		t.Signature = crypto.Signature{Type: crypto.SigType(sig[0]), Data: sig[1:]}
+
+	}
+	return nil
+}
+
 var lengthBufMessage = []byte{138}
 
 func (t *Message) MarshalCBOR(w io.Writer) error {
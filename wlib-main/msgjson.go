@@ -0,0 +1,141 @@
+package wlib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// messageJSON 是 lotus JSON-RPC 中 Message 的格式，地址单独处理以支持 f4。
+// encoding/json 匹配字段名时不区分大小写，所以旧的小写 Msg json 也能解析。
+type messageJSON struct {
+	Version    uint64
+	To         string
+	From       string
+	Nonce      uint64
+	Value      abi.TokenAmount
+	GasLimit   int64
+	GasFeeCap  abi.TokenAmount
+	GasPremium abi.TokenAmount
+	Method     abi.MethodNum
+	Params     []byte
+	CID        *cid.Cid `json:",omitempty"`
+}
+
+// MarshalJSON 输出 lotus 的格式，带 {"/": cid} 形式的 CID 字段
+func (m *Message) MarshalJSON() ([]byte, error) {
+	c := m.Cid()
+	return json.Marshal(&messageJSON{
+		Version:    m.Version,
+		To:         m.To.String(),
+		From:       m.From.String(),
+		Nonce:      m.Nonce,
+		Value:      m.Value,
+		GasLimit:   m.GasLimit,
+		GasFeeCap:  m.GasFeeCap,
+		GasPremium: m.GasPremium,
+		Method:     m.Method,
+		Params:     m.Params,
+		CID:        &c,
+	})
+}
+
+// UnmarshalJSON 接受 lotus 格式和旧的小写 Msg 格式，CID 字段被忽略
+func (m *Message) UnmarshalJSON(b []byte) error {
+	var mj messageJSON
+	if err := json.Unmarshal(b, &mj); err != nil {
+		return err
+	}
+
+	to, err := address.NewFromString(mj.To)
+	if err != nil {
+		return xerrors.Errorf("invalid to address(%s): %v", mj.To, err)
+	}
+	from, err := address.NewFromString(mj.From)
+	if err != nil {
+		return xerrors.Errorf("invalid from address(%s): %v", mj.From, err)
+	}
+
+	*m = Message{
+		Version:    mj.Version,
+		To:         to,
+		From:       from,
+		Nonce:      mj.Nonce,
+		Value:      mj.Value,
+		GasLimit:   mj.GasLimit,
+		GasFeeCap:  mj.GasFeeCap,
+		GasPremium: mj.GasPremium,
+		Method:     mj.Method,
+		Params:     mj.Params,
+	}
+	return nil
+}
+
+type signedMessageJSON struct {
+	Message   *Message
+	Signature crypto.Signature
+	CID       *cid.Cid `json:",omitempty"`
+}
+
+func (sm *SignedMessage) MarshalJSON() ([]byte, error) {
+	c := sm.Cid()
+	return json.Marshal(&signedMessageJSON{
+		Message:   &sm.Message,
+		Signature: sm.Signature,
+		CID:       &c,
+	})
+}
+
+func (sm *SignedMessage) UnmarshalJSON(b []byte) error {
+	var smj signedMessageJSON
+	if err := json.Unmarshal(b, &smj); err != nil {
+		return err
+	}
+	if smj.Message == nil {
+		return xerrors.Errorf("missing message")
+	}
+
+	*sm = SignedMessage{Message: *smj.Message, Signature: smj.Signature}
+	return nil
+}
+
+var (
+	_ json.Marshaler   = (*Message)(nil)
+	_ json.Unmarshaler = (*Message)(nil)
+	_ json.Marshaler   = (*SignedMessage)(nil)
+	_ json.Unmarshaler = (*SignedMessage)(nil)
+)
+
+// LotusMessageJSON 把 Msg json（旧格式或 lotus 格式）转换为 lotus JSON-RPC 的格式
+func LotusMessageJSON(jsonstr string) string {
+	var m Message
+	if err := json.Unmarshal([]byte(jsonstr), &m); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid message json: %v", err))
+	}
+
+	return jsonOut(&m)
+}
+
+// LotusSignedMessageJSON 组装可以直接 MpoolPush 的签名消息
+// sigType 1 为 secp256k1，2 为 bls，3 为 delegated；sig 为 base64 的签名
+func LotusSignedMessageJSON(jsonstr string, sigType int, sig string) string {
+	var m Message
+	if err := json.Unmarshal([]byte(jsonstr), &m); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid message json: %v", err))
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid signature: %v", err))
+	}
+
+	return jsonOut(&SignedMessage{
+		Message:   m,
+		Signature: crypto.Signature{Type: crypto.SigType(sigType), Data: data},
+	})
+}
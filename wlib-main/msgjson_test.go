@@ -0,0 +1,37 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestLotusMessageJSON(t *testing.T) {
+	out := wlib.LotusMessageJSON(feeMsg)
+
+	var lotus map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &lotus))
+	require.Equal(t, "1000000000000000000", lotus["Value"])
+	require.Equal(t, float64(1000000), lotus["GasLimit"])
+	require.Equal(t, map[string]interface{}{"/": wlib.GenCid(feeMsg)}, lotus["CID"])
+
+	// lotus output parses back to the same message
+	var m wlib.Message
+	require.NoError(t, json.Unmarshal([]byte(out), &m))
+	require.Equal(t, wlib.GenCid(feeMsg), m.Cid().String())
+
+	sig := base64.StdEncoding.EncodeToString(make([]byte, 65))
+	signed := wlib.LotusSignedMessageJSON(out, 1, sig)
+
+	var sm wlib.SignedMessage
+	require.NoError(t, json.Unmarshal([]byte(signed), &sm))
+	require.Equal(t, m, sm.Message)
+	require.Len(t, sm.Signature.Data, 65)
+
+	require.NoError(t, json.Unmarshal([]byte(signed), &lotus))
+	require.Equal(t, map[string]interface{}{"/": sm.Cid().String()}, lotus["CID"])
+	require.Equal(t, map[string]interface{}{"Type": float64(1), "Data": sig}, lotus["Signature"])
+}
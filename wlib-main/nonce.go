@@ -0,0 +1,362 @@
+package wlib
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"golang.org/x/xerrors"
+)
+
+// NonceRecord 是一个地址在本地分配过的 nonce
+type NonceRecord struct {
+	// Next 下一个分配的 nonce
+	Next uint64 `json:"next"`
+	// Pending 已分配但还未上链的 nonce，值为推送后的消息 cid，未推送时为空
+	Pending map[uint64]string `json:"pending"`
+}
+
+// NonceStore 持久化 NonceRecord，addr 是账户的公钥地址，Load 在没有记录时返回 nil, nil
+type NonceStore interface {
+	Load(addr string) (*NonceRecord, error)
+	Save(addr string, rec *NonceRecord) error
+}
+
+// NonceChain 是对账需要的链上数据，*Client 实现了它。
+// 地址还没有上链时，StateGetActor 和 StateLookupID 返回 ErrActorNotFound
+type NonceChain interface {
+	StateGetActor(ctx context.Context, addr address.Address) (*Actor, error)
+	StateLookupID(ctx context.Context, addr address.Address) (address.Address, error)
+	StateAccountKey(ctx context.Context, addr address.Address) (address.Address, error)
+	MpoolPending(ctx context.Context) ([]*SignedMessage, error)
+}
+
+// MpoolPending 返回消息池中所有待打包的消息
+func (c *Client) MpoolPending(ctx context.Context) ([]*SignedMessage, error) {
+	var out []*SignedMessage
+	if err := c.Call(ctx, "Filecoin.MpoolPending", &out, nil); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type memNonceStore struct {
+	mu   sync.Mutex
+	recs map[string][]byte
+}
+
+// NewMemoryNonceStore 内存存储，进程退出后丢失
+func NewMemoryNonceStore() NonceStore {
+	return &memNonceStore{recs: map[string][]byte{}}
+}
+
+func (s *memNonceStore) Load(addr string) (*NonceRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.recs[addr]
+	if !ok {
+		return nil, nil
+	}
+	var rec NonceRecord
+	return &rec, json.Unmarshal(b, &rec)
+}
+
+func (s *memNonceStore) Save(addr string, rec *NonceRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs[addr] = b
+	return nil
+}
+
+type fileNonceStore struct {
+	dir string
+}
+
+// NewFileNonceStore 每个地址一个 json 文件，保存在 dir 下
+func NewFileNonceStore(dir string) (NonceStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("failed to create nonce store %s: %v", dir, err)
+	}
+	return &fileNonceStore{dir: dir}, nil
+}
+
+func (s *fileNonceStore) path(addr string) string {
+	return filepath.Join(s.dir, strings.ReplaceAll(addr, string(filepath.Separator), "_")+".json")
+}
+
+func (s *fileNonceStore) Load(addr string) (*NonceRecord, error) {
+	b, err := ioutil.ReadFile(s.path(addr))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec NonceRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, xerrors.Errorf("corrupt nonce record for %s: %v", addr, err)
+	}
+	return &rec, nil
+}
+
+// Save 先写临时文件再 rename，避免写到一半时进程退出
+func (s *fileNonceStore) Save(addr string, rec *NonceRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(addr) + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(addr))
+}
+
+// NonceStatus 是 Reconcile 的结果
+type NonceStatus struct {
+	Address    string   `json:"address"`
+	ChainNonce uint64   `json:"chain_nonce"`
+	Next       uint64   `json:"next"`
+	Mempool    []uint64 `json:"mempool"`
+	// Gaps 是 [ChainNonce, Next) 中不在消息池里的 nonce，它们之后的消息都无法上链
+	Gaps []uint64 `json:"gaps"`
+}
+
+// NonceManager 为同一地址的并发发送分配唯一且连续的 nonce，
+// 避免多次 MpoolGetNonce 拿到相同的值
+type NonceManager struct {
+	mu    sync.Mutex
+	store NonceStore
+	chain NonceChain
+}
+
+func NewNonceManager(store NonceStore, chain NonceChain) *NonceManager {
+	return &NonceManager{store: store, chain: chain}
+}
+
+// recordKey 返回 addr 的记录键。同一账户可以用 ID 地址或公钥地址发送，
+// 统一用公钥地址作键，两种写法共用一条记录
+func (nm *NonceManager) recordKey(ctx context.Context, addr address.Address) (string, error) {
+	if addr.Protocol() != address.ID {
+		return addr.String(), nil
+	}
+	key, err := nm.chain.StateAccountKey(ctx, addr)
+	if err != nil {
+		return "", xerrors.Errorf("failed to get account key of %s: %v", addr.String(), err)
+	}
+	return key.String(), nil
+}
+
+// get 读取记录，没有记录时返回 nil
+func (nm *NonceManager) get(key string) (*NonceRecord, error) {
+	rec, err := nm.store.Load(key)
+	if err != nil || rec == nil {
+		return nil, err
+	}
+	if rec.Pending == nil {
+		rec.Pending = map[uint64]string{}
+	}
+	return rec, nil
+}
+
+func (nm *NonceManager) load(ctx context.Context, addr address.Address, key string) (*NonceRecord, error) {
+	rec, err := nm.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		return rec, nil
+	}
+
+	rec = &NonceRecord{Pending: map[uint64]string{}}
+	if _, err := nm.reconcile(ctx, addr, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Next 分配下一个 nonce，第一次使用某个地址时先与链上对账
+func (nm *NonceManager) Next(ctx context.Context, addr address.Address) (uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	key, err := nm.recordKey(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	rec, err := nm.load(ctx, addr, key)
+	if err != nil {
+		return 0, err
+	}
+
+	n := rec.Next
+	rec.Pending[n] = ""
+	rec.Next++
+	if err := nm.store.Save(key, rec); err != nil {
+		return 0, xerrors.Errorf("failed to save nonce record: %v", err)
+	}
+	return n, nil
+}
+
+// MarkPushed 记录 nonce 对应的消息已推送
+func (nm *NonceManager) MarkPushed(ctx context.Context, addr address.Address, nonce uint64, msgCid string) error {
+	return nm.update(ctx, addr, func(rec *NonceRecord) {
+		if _, ok := rec.Pending[nonce]; ok {
+			rec.Pending[nonce] = msgCid
+		}
+	})
+}
+
+// Release 归还签名或推送失败的 nonce；只有最后分配的 nonce 能收回，否则会留下空缺
+func (nm *NonceManager) Release(ctx context.Context, addr address.Address, nonce uint64) error {
+	return nm.update(ctx, addr, func(rec *NonceRecord) {
+		if rec.Pending[nonce] != "" {
+			return
+		}
+		delete(rec.Pending, nonce)
+		if nonce+1 == rec.Next {
+			rec.Next = nonce
+		}
+	})
+}
+
+func (nm *NonceManager) update(ctx context.Context, addr address.Address, fn func(rec *NonceRecord)) error {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	key, err := nm.recordKey(ctx, addr)
+	if err != nil {
+		return err
+	}
+	rec, err := nm.get(key)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return xerrors.Errorf("no nonce assigned for %s", addr.String())
+	}
+
+	fn(rec)
+	return nm.store.Save(key, rec)
+}
+
+// Reconcile 与链上 nonce 和消息池对账：清除已上链的记录，
+// Next 不小于链上和消息池中的 nonce，并报告空缺
+func (nm *NonceManager) Reconcile(ctx context.Context, addr address.Address) (*NonceStatus, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	key, err := nm.recordKey(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := nm.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		rec = &NonceRecord{Pending: map[uint64]string{}}
+	}
+
+	st, err := nm.reconcile(ctx, addr, rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := nm.store.Save(key, rec); err != nil {
+		return nil, xerrors.Errorf("failed to save nonce record: %v", err)
+	}
+	return st, nil
+}
+
+func (nm *NonceManager) reconcile(ctx context.Context, addr address.Address, rec *NonceRecord) (*NonceStatus, error) {
+	st := &NonceStatus{Address: addr.String()}
+
+	act, err := nm.chain.StateGetActor(ctx, addr)
+	switch {
+	case err == nil:
+		st.ChainNonce = act.Nonce
+	case xerrors.Is(err, ErrActorNotFound):
+		// 新地址还没有上链
+	default:
+		return nil, xerrors.Errorf("failed to get actor %s: %v", st.Address, err)
+	}
+
+	senders, err := nm.senderForms(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := nm.chain.MpoolPending(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get mempool pending: %v", err)
+	}
+
+	inMpool := map[uint64]bool{}
+	next := st.ChainNonce
+	for _, sm := range pending {
+		if !senders[sm.Message.From] || sm.Message.Nonce < st.ChainNonce {
+			continue
+		}
+		inMpool[sm.Message.Nonce] = true
+		st.Mempool = append(st.Mempool, sm.Message.Nonce)
+		if sm.Message.Nonce >= next {
+			next = sm.Message.Nonce + 1
+		}
+	}
+	sort.Slice(st.Mempool, func(i, j int) bool { return st.Mempool[i] < st.Mempool[j] })
+
+	for n := range rec.Pending {
+		if n < st.ChainNonce {
+			delete(rec.Pending, n)
+		}
+	}
+	if rec.Next < next {
+		rec.Next = next
+	}
+	st.Next = rec.Next
+
+	for n := st.ChainNonce; n < rec.Next; n++ {
+		if !inMpool[n] {
+			st.Gaps = append(st.Gaps, n)
+		}
+	}
+	return st, nil
+}
+
+// senderForms 返回 addr 的 ID 地址和公钥地址，消息池里的消息可能使用其中任何一种
+func (nm *NonceManager) senderForms(ctx context.Context, addr address.Address) (map[address.Address]bool, error) {
+	forms := map[address.Address]bool{addr: true}
+
+	id, err := nm.chain.StateLookupID(ctx, addr)
+	switch {
+	case err == nil:
+		forms[id] = true
+	case xerrors.Is(err, ErrActorNotFound):
+		return forms, nil
+	default:
+		return nil, xerrors.Errorf("failed to look up id of %s: %v", addr.String(), err)
+	}
+
+	if addr.Protocol() == address.ID {
+		key, err := nm.chain.StateAccountKey(ctx, addr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get account key of %s: %v", addr.String(), err)
+		}
+		forms[key] = true
+	}
+	return forms, nil
+}
@@ -0,0 +1,140 @@
+package wlib_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+	"golang.org/x/xerrors"
+)
+
+// fakeChain has a single account; from is the sender of its mempool messages
+// and key its public key address.
+type fakeChain struct {
+	nonce   uint64
+	mempool []uint64
+	from    address.Address
+	key     address.Address
+}
+
+func (c *fakeChain) StateGetActor(context.Context, address.Address) (*wlib.Actor, error) {
+	if c.nonce == 0 {
+		return nil, xerrors.Errorf("resolution lookup failed: %w", wlib.ErrActorNotFound)
+	}
+	return &wlib.Actor{Nonce: c.nonce}, nil
+}
+
+func (c *fakeChain) StateLookupID(_ context.Context, addr address.Address) (address.Address, error) {
+	if c.nonce == 0 {
+		return address.Undef, xerrors.Errorf("resolution lookup failed: %w", wlib.ErrActorNotFound)
+	}
+	id, _ := address.NewIDAddress(1001)
+	return id, nil
+}
+
+func (c *fakeChain) StateAccountKey(context.Context, address.Address) (address.Address, error) {
+	return c.key, nil
+}
+
+func (c *fakeChain) MpoolPending(context.Context) ([]*wlib.SignedMessage, error) {
+	var out []*wlib.SignedMessage
+	for _, n := range c.mempool {
+		out = append(out, &wlib.SignedMessage{Message: wlib.Message{From: c.from, Nonce: n}})
+	}
+	return out, nil
+}
+
+var testNonceKey, _ = address.NewFromString(wlib.GenAddress(wlib.SecpPrivateToPublic("67WMRDA2ldmfcQ87DSHCy+ppKs3iSyNjxfBD7dR68Qw="), "secp"))
+
+func TestNonceManagerConcurrent(t *testing.T) {
+	from, _ := address.NewIDAddress(1001)
+	chain := &fakeChain{nonce: 10, mempool: []uint64{10, 11}, from: from, key: testNonceKey}
+	nm := wlib.NewNonceManager(wlib.NewMemoryNonceStore(), chain)
+
+	var mu sync.Mutex
+	var got []uint64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := nm.Next(context.Background(), from)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			got = append(got, n)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	for i, n := range got {
+		require.Equal(t, uint64(12+i), n)
+	}
+
+	// the key address shares the record of its ID address
+	n, err := nm.Next(context.Background(), testNonceKey)
+	require.NoError(t, err)
+	require.Equal(t, uint64(62), n)
+}
+
+func TestNonceManagerReconcile(t *testing.T) {
+	from, _ := address.NewIDAddress(1001)
+	chain := &fakeChain{from: from, key: testNonceKey}
+	store, err := wlib.NewFileNonceStore(t.TempDir())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	nm := wlib.NewNonceManager(store, chain)
+	for i := uint64(0); i < 4; i++ {
+		n, err := nm.Next(ctx, from)
+		require.NoError(t, err)
+		require.Equal(t, i, n)
+	}
+	require.NoError(t, nm.MarkPushed(ctx, from, 2, "bafy2bzace"))
+	require.NoError(t, nm.Release(ctx, from, 3))
+
+	// 0 and 1 were mined, 2 is lost from the mempool
+	chain.nonce = 2
+	st, err := wlib.NewNonceManager(store, chain).Reconcile(ctx, from)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), st.Next)
+	require.Equal(t, []uint64{2}, st.Gaps)
+
+	chain.mempool = []uint64{2, 3, 4}
+	st, err = nm.Reconcile(ctx, from)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), st.Next)
+	require.Empty(t, st.Gaps)
+
+	n, err := nm.Next(ctx, from)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), n)
+}
+
+func TestNonceManagerReconcileIDSender(t *testing.T) {
+	id, _ := address.NewIDAddress(1001)
+	key := testNonceKey
+	ctx := context.Background()
+
+	// the wallet tracks the key address, the mempool has the messages under the ID address
+	chain := &fakeChain{nonce: 4, mempool: []uint64{4, 5}, from: id, key: key}
+	st, err := wlib.NewNonceManager(wlib.NewMemoryNonceStore(), chain).Reconcile(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 5}, st.Mempool)
+	require.Equal(t, uint64(6), st.Next)
+
+	// and the other way round
+	chain.from = key
+	st, err = wlib.NewNonceManager(wlib.NewMemoryNonceStore(), chain).Reconcile(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{4, 5}, st.Mempool)
+	require.Empty(t, st.Gaps)
+}
@@ -6,6 +6,8 @@ import (
 	multisig0 "github.com/filecoin-project/specs-actors/actors/builtin/multisig"
 	 "github.com/filecoin-project/specs-actors/v5/actors/builtin/power"
 	multisig2 "github.com/filecoin-project/specs-actors/v2/actors/builtin/multisig"
+	paych5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/paych"
+	verifreg5 "github.com/filecoin-project/specs-actors/v5/actors/builtin/verifreg"
 )
 
 // type ConstructorParams struct {
@@ -30,4 +32,12 @@ type ProposalHashData = multisig0.ProposalHashData
 type Transaction = multisig0.Transaction
 type TxnIDParams = multisig0.TxnIDParams
 type TxnID = multisig0.TxnID
-type CreateMinerParams= power.CreateMinerParams
\ No newline at end of file
+type CreateMinerParams= power.CreateMinerParams
+
+type PaychConstructorParams = paych5.ConstructorParams
+type SignedVoucher = paych5.SignedVoucher
+type Merge = paych5.Merge
+type UpdateChannelStateParams = paych5.UpdateChannelStateParams
+
+type AddVerifierParams = verifreg5.AddVerifierParams
+type AddVerifiedClientParams = verifreg5.AddVerifiedClientParams
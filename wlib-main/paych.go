@@ -0,0 +1,273 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"golang.org/x/xerrors"
+)
+
+// Settle and Collect (builtin5.MethodsPaych.Settle / Collect) take no params:
+// send them to the channel address with an empty Params field.
+
+// GenCreatePaych 创建支付通道，通过 init actor (f01) Exec 调用
+// from 为付款人，to 为收款人，通道的初始金额放在消息的 Value 里
+// 输出与 GenConstructorParamV3 相同 {"param": "..."}
+func GenCreatePaych(from, to string) string {
+	payer, err := address.NewFromString(from)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid from address(%s): %v", from, err))
+	}
+
+	payee, err := address.NewFromString(to)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid to address(%s): %v", to, err))
+	}
+
+	enc, err := SerializeParams(&PaychConstructorParams{From: payer, To: payee})
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize paych constructor params: %v", err))
+	}
+
+	enc, err = SerializeParams(&ExecParams{
+		CodeCID:           builtin5.PaymentChannelActorCodeID,
+		ConstructorParams: enc,
+	})
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize ExecParams: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+type MergeInput struct {
+	Lane  uint64 `json:"lane"`
+	Nonce uint64 `json:"nonce"`
+}
+
+// VoucherInput 凭证的 json 格式
+//
+//	{
+//	 "channel_addr": "f0100",
+//	 "lane": 0,
+//	 "nonce": 1,
+//	 "amount": "1000000000000000000",
+//	 "time_lock_min": 0,
+//	 "time_lock_max": 0,
+//	 "min_settle_height": 0,
+//	 "secret_preimage": "",
+//	 "merges": [{"lane": 1, "nonce": 3}]
+//	}
+//
+// amount 单位为 attoFIL，secret_preimage 为 base64
+type VoucherInput struct {
+	ChannelAddr     string       `json:"channel_addr"`
+	Lane            uint64       `json:"lane"`
+	Nonce           uint64       `json:"nonce"`
+	Amount          string       `json:"amount"`
+	TimeLockMin     int64        `json:"time_lock_min"`
+	TimeLockMax     int64        `json:"time_lock_max"`
+	MinSettleHeight int64        `json:"min_settle_height"`
+	SecretPreimage  string       `json:"secret_preimage,omitempty"`
+	Merges          []MergeInput `json:"merges,omitempty"`
+}
+
+func (v *VoucherInput) Transfer() (*SignedVoucher, error) {
+	ch, err := address.NewFromString(v.ChannelAddr)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid channel address(%s): %v", v.ChannelAddr, err)
+	}
+
+	amount, err := ParseFIL(fmt.Sprintf("%s afil", v.Amount))
+	if err != nil {
+		return nil, xerrors.Errorf("invalid amount(%s): %v", v.Amount, err)
+	}
+	if amount.Sign() <= 0 {
+		return nil, xerrors.Errorf("voucher amount must be positive, got %s", v.Amount)
+	}
+
+	preimage, err := base64.StdEncoding.DecodeString(v.SecretPreimage)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid secret_preimage(%s): %v", v.SecretPreimage, err)
+	}
+	if len(preimage) == 0 {
+		preimage = nil
+	}
+
+	var merges []Merge
+	for _, m := range v.Merges {
+		if m.Lane == v.Lane {
+			return nil, xerrors.Errorf("voucher cannot merge lane %d into itself", m.Lane)
+		}
+		merges = append(merges, Merge{Lane: m.Lane, Nonce: m.Nonce})
+	}
+
+	return &SignedVoucher{
+		ChannelAddr:     ch,
+		TimeLockMin:     abi.ChainEpoch(v.TimeLockMin),
+		TimeLockMax:     abi.ChainEpoch(v.TimeLockMax),
+		SecretPreimage:  preimage,
+		Lane:            v.Lane,
+		Nonce:           v.Nonce,
+		Amount:          BigInt(amount),
+		MinSettleHeight: abi.ChainEpoch(v.MinSettleHeight),
+		Merges:          merges,
+	}, nil
+}
+
+// GenVoucher 生成未签名的凭证，返回待签名的字节 {"param": "..."}
+// 可以交给 SecpSign 以外的签名器（比如硬件钱包）签名
+func GenVoucher(input string) string {
+	var v VoucherInput
+	if err := json.Unmarshal([]byte(input), &v); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid input json: %s, %v", input, err))
+	}
+
+	sv, err := v.Transfer()
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	enc, err := sv.SigningBytes()
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize voucher: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+// SignVoucher 用 secp256k1 私钥（base64）创建并签名凭证
+// 输出签名后的凭证 CBOR {"param": "..."}，可直接发给收款人
+func SignVoucher(ck, input string) string {
+	key, err := base64.StdEncoding.DecodeString(ck)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid private key: %v", err))
+	}
+
+	var v VoucherInput
+	if err := json.Unmarshal([]byte(input), &v); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid input json: %s, %v", input, err))
+	}
+
+	sv, err := v.Transfer()
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	data, err := sv.SigningBytes()
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize voucher: %v", err))
+	}
+
+	sv.Signature, err = secpSign(key, data)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to sign voucher: %v", err))
+	}
+
+	enc, err := SerializeParams(sv)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize signed voucher: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+func decodeVoucher(voucher string) (*SignedVoucher, error) {
+	b, err := base64.StdEncoding.DecodeString(voucher)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid voucher base64: %v", err)
+	}
+
+	var sv SignedVoucher
+	if err := sv.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, xerrors.Errorf("failed to decode voucher: %v", err)
+	}
+
+	return &sv, nil
+}
+
+func verifyVoucher(payer address.Address, sv, last *SignedVoucher) error {
+	data, err := sv.SigningBytes()
+	if err != nil {
+		return xerrors.Errorf("failed to serialize voucher: %v", err)
+	}
+
+	if err := secpVerify(payer, data, sv.Signature); err != nil {
+		return xerrors.Errorf("invalid voucher signature: %v", err)
+	}
+
+	if last == nil {
+		return nil
+	}
+
+	if sv.ChannelAddr != last.ChannelAddr {
+		return xerrors.Errorf("voucher is for channel %s, previous voucher was for %s", sv.ChannelAddr, last.ChannelAddr)
+	}
+	if sv.Lane != last.Lane {
+		return xerrors.Errorf("voucher is for lane %d, previous voucher was for lane %d", sv.Lane, last.Lane)
+	}
+	if sv.Nonce <= last.Nonce {
+		return xerrors.Errorf("voucher nonce %d must be greater than previous nonce %d", sv.Nonce, last.Nonce)
+	}
+	if BigCmp(sv.Amount, last.Amount) <= 0 {
+		return xerrors.Errorf("voucher amount %s must be greater than previous amount %s", sv.Amount, last.Amount)
+	}
+
+	return nil
+}
+
+// VerifyVoucher 收款人校验收到的凭证
+// payer 为付款人地址（仅支持 f1），voucher 为签名后的凭证（base64）
+// last 为同一 lane 上次接受的凭证（base64），为空表示第一张凭证
+// 校验签名、通道与 lane 一致、nonce 和金额单调递增
+// 成功返回 {}，失败返回 {"err": "..."}
+func VerifyVoucher(payer, voucher, last string) string {
+	from, err := address.NewFromString(payer)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid payer address(%s): %v", payer, err))
+	}
+
+	sv, err := decodeVoucher(voucher)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	var prev *SignedVoucher
+	if last != "" {
+		prev, err = decodeVoucher(last)
+		if err != nil {
+			return genOut(nil, xerrors.Errorf("invalid previous voucher: %v", err))
+		}
+	}
+
+	return genOut(nil, verifyVoucher(from, sv, prev))
+}
+
+// GenUpdateChannelStateParam 生成 UpdateChannelState 的参数
+// voucher 为签名后的凭证（base64），secret 为可选的 base64 原像
+func GenUpdateChannelStateParam(voucher, secret string) string {
+	sv, err := decodeVoucher(voucher)
+	if err != nil {
+		return genOut(nil, err)
+	}
+
+	s, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid secret(%s): %v", secret, err))
+	}
+	if len(s) == 0 {
+		s = nil
+	}
+
+	enc, err := SerializeParams(&UpdateChannelStateParams{Sv: *sv, Secret: s})
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize UpdateChannelStateParams: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
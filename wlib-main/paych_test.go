@@ -0,0 +1,42 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func parseOut(t *testing.T, s string) wlib.Out {
+	var o wlib.Out
+	require.NoError(t, json.Unmarshal([]byte(s), &o))
+	return o
+}
+
+func TestVoucherLifecycle(t *testing.T) {
+	ck := "67WMRDA2ldmfcQ87DSHCy+ppKs3iSyNjxfBD7dR68Qw="
+	payer := wlib.GenAddress(wlib.SecpPrivateToPublic(ck), "secp")
+
+	create := parseOut(t, wlib.GenCreatePaych(payer, "f01234"))
+	require.Equal(t, "", create.Err)
+
+	v1 := parseOut(t, wlib.SignVoucher(ck, `{"channel_addr": "f0100", "lane": 0, "nonce": 1, "amount": "1000"}`))
+	require.Equal(t, "", v1.Err)
+	v2 := parseOut(t, wlib.SignVoucher(ck, `{"channel_addr": "f0100", "lane": 0, "nonce": 2, "amount": "2000"}`))
+	require.Equal(t, "", v2.Err)
+
+	enc := func(b []byte) string {
+		s, _ := json.Marshal(b)
+		return string(s[1 : len(s)-1])
+	}
+
+	require.Equal(t, "", parseOut(t, wlib.VerifyVoucher(payer, enc(v1.Param), "")).Err)
+	require.Equal(t, "", parseOut(t, wlib.VerifyVoucher(payer, enc(v2.Param), enc(v1.Param))).Err)
+	require.Contains(t, parseOut(t, wlib.VerifyVoucher(payer, enc(v1.Param), enc(v2.Param))).Err, "nonce")
+	require.Contains(t, parseOut(t, wlib.VerifyVoucher("f1lrgw6ss5nu5lbhqmmtthc7hmxg6hlt5r6txpy3i", enc(v1.Param), "")).Err, "signature")
+
+	upd := parseOut(t, wlib.GenUpdateChannelStateParam(enc(v2.Param), ""))
+	require.Equal(t, "", upd.Err)
+	require.NotEmpty(t, upd.Param)
+}
@@ -0,0 +1,228 @@
+package wlib
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"golang.org/x/xerrors"
+)
+
+// PaymentURIScheme 收款链接的 scheme，格式参考 BIP 21
+//
+//	filecoin:f1abc...?value=1.5&method=0&params=<base64>&label=Shop&message=Order%201234
+//
+// value 单位为 FIL，params 为 base64。以 req- 开头的未知参数表示必须理解，
+// 解析时报错，其余未知参数忽略
+const PaymentURIScheme = "filecoin"
+
+// PaymentRequest 是收款链接的内容
+type PaymentRequest struct {
+	To     address.Address
+	Value  abi.TokenAmount
+	Method abi.MethodNum
+	Params []byte
+	// Label 收款方名称，Message 付款说明，只用于显示
+	Label   string
+	Message string
+}
+
+// parsePaymentAddress 解析收款地址，网络前缀必须和 address.CurrentNetwork 一致，
+// 不能把另一个网络的地址改成当前网络的前缀去付款
+func parsePaymentAddress(s string) (address.Address, error) {
+	a, err := address.NewFromString(s)
+	if err != nil {
+		return address.Undef, xerrors.Errorf("invalid address(%s)", s)
+	}
+	prefix := address.TestnetPrefix
+	if address.CurrentNetwork == address.Mainnet {
+		prefix = address.MainnetPrefix
+	}
+	if !strings.HasPrefix(s, prefix) {
+		return address.Undef, xerrors.Errorf("address(%s) is not on the current network, expected prefix %s", s, prefix)
+	}
+	return a, nil
+}
+
+// ParsePaymentURI 解析收款链接，地址的网络前缀必须是当前网络的
+func ParsePaymentURI(uri string) (*PaymentRequest, error) {
+	uri = strings.TrimSpace(uri)
+	i := strings.Index(uri, ":")
+	if i < 0 || !strings.EqualFold(uri[:i], PaymentURIScheme) {
+		return nil, xerrors.Errorf("not a %s: uri", PaymentURIScheme)
+	}
+
+	rest := strings.TrimPrefix(uri[i+1:], "//")
+	to, rawQuery := rest, ""
+	if j := strings.Index(rest, "?"); j >= 0 {
+		to, rawQuery = rest[:j], rest[j+1:]
+	}
+
+	toAddr, err := parsePaymentAddress(strings.TrimSuffix(to, "/"))
+	if err != nil {
+		return nil, err
+	}
+	r := &PaymentRequest{To: toAddr, Value: NewInt(0)}
+
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid query: %v", err)
+	}
+	for k, v := range q {
+		if len(v) != 1 {
+			return nil, xerrors.Errorf("parameter %s is given %d times", k, len(v))
+		}
+		switch k {
+		case "value":
+			f, err := ParseFIL(v[0])
+			if err != nil || f.Sign() < 0 {
+				return nil, xerrors.Errorf("invalid value(%s): %v", v[0], err)
+			}
+			r.Value = abi.TokenAmount(f)
+		case "method":
+			m, err := strconv.ParseUint(v[0], 10, 64)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid method(%s): %v", v[0], err)
+			}
+			r.Method = abi.MethodNum(m)
+		case "params":
+			if r.Params, err = base64.StdEncoding.DecodeString(v[0]); err != nil {
+				return nil, xerrors.Errorf("invalid params: %v", err)
+			}
+		case "label":
+			r.Label = v[0]
+		case "message":
+			r.Message = v[0]
+		default:
+			if strings.HasPrefix(k, "req-") {
+				return nil, xerrors.Errorf("unsupported required parameter %s", k)
+			}
+		}
+	}
+	return r, nil
+}
+
+// String 生成收款链接，零值的参数省略
+func (r *PaymentRequest) String() string {
+	q := url.Values{}
+	if !r.Value.Nil() && r.Value.Sign() != 0 {
+		q.Set("value", FIL(r.Value).Unitless())
+	}
+	if r.Method != 0 {
+		q.Set("method", strconv.FormatUint(uint64(r.Method), 10))
+	}
+	if len(r.Params) > 0 {
+		q.Set("params", base64.StdEncoding.EncodeToString(r.Params))
+	}
+	if r.Label != "" {
+		q.Set("label", r.Label)
+	}
+	if r.Message != "" {
+		q.Set("message", r.Message)
+	}
+
+	uri := PaymentURIScheme + ":" + r.To.String()
+	if len(q) > 0 {
+		uri += "?" + strings.ReplaceAll(q.Encode(), "+", "%20")
+	}
+	return uri
+}
+
+// Msg 生成付款消息，nonce 和 gas 需要另外填写
+func (r *PaymentRequest) Msg(from address.Address) *Msg {
+	return newMsg(&Message{
+		To:         r.To,
+		From:       from,
+		Value:      r.Value,
+		GasFeeCap:  NewInt(0),
+		GasPremium: NewInt(0),
+		Method:     r.Method,
+		Params:     r.Params,
+	})
+}
+
+// PaymentURIOut 是 GenPaymentURI 和 DecodePaymentURI 的输出
+type PaymentURIOut struct {
+	Err      string `json:"err,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	To       string `json:"to,omitempty"`
+	Value    string `json:"value,omitempty"`
+	ValueFIL string `json:"value_fil,omitempty"`
+	Method   uint64 `json:"method"`
+	Params   string `json:"params,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// Msg 只有给出 from 时才有
+	Msg *Msg `json:"msg,omitempty"`
+}
+
+func paymentURIOut(r *PaymentRequest, from address.Address, err error) string {
+	o := &PaymentURIOut{}
+	if err != nil {
+		o.Err = err.Error()
+	} else {
+		o.URI = r.String()
+		o.To = r.To.String()
+		o.Value = r.Value.String()
+		o.ValueFIL = FIL(r.Value).String()
+		o.Method = uint64(r.Method)
+		o.Params = base64.StdEncoding.EncodeToString(r.Params)
+		o.Label = r.Label
+		o.Message = r.Message
+		if from != address.Undef {
+			o.Msg = r.Msg(from)
+		}
+	}
+
+	return jsonOut(o)
+}
+
+// GenPaymentURI 生成收款链接，to 的网络前缀必须是当前网络的，value 如 "1.5" 或 "1.5 FIL"，method 为空时为 0，params 为 base64
+// 输出 {"uri": "filecoin:f1...?value=1.5", "to": "f1...", "value": "1500000000000000000", ...}
+func GenPaymentURI(to, value, method, params, label, message string) string {
+	toAddr, err := parsePaymentAddress(to)
+	if err != nil {
+		return paymentURIOut(nil, address.Undef, err)
+	}
+
+	r := &PaymentRequest{To: toAddr, Value: NewInt(0), Label: label, Message: message}
+	if value != "" {
+		f, err := ParseFIL(value)
+		if err != nil || f.Sign() < 0 {
+			return paymentURIOut(nil, address.Undef, xerrors.Errorf("invalid value(%s): %v", value, err))
+		}
+		r.Value = abi.TokenAmount(f)
+	}
+	if method != "" {
+		m, err := strconv.ParseUint(method, 10, 64)
+		if err != nil {
+			return paymentURIOut(nil, address.Undef, xerrors.Errorf("invalid method(%s): %v", method, err))
+		}
+		r.Method = abi.MethodNum(m)
+	}
+	if r.Params, err = base64.StdEncoding.DecodeString(params); err != nil {
+		return paymentURIOut(nil, address.Undef, xerrors.Errorf("invalid params: %v", err))
+	}
+
+	return paymentURIOut(r, address.Undef, nil)
+}
+
+// DecodePaymentURI 解析收款链接，from 不为空时同时生成待填写 nonce 和 gas 的消息
+// 输出同 GenPaymentURI，另有 "msg": {"to": ..., "from": ..., "value": ..., "nonce": 0, "gaslimit": 0, ...}
+func DecodePaymentURI(uri, from string) string {
+	r, err := ParsePaymentURI(uri)
+	if err != nil {
+		return paymentURIOut(nil, address.Undef, err)
+	}
+
+	var fromAddr address.Address
+	if from != "" {
+		if fromAddr, err = address.NewFromString(from); err != nil {
+			return paymentURIOut(nil, address.Undef, xerrors.Errorf("invalid from address(%s): %v", from, err))
+		}
+	}
+	return paymentURIOut(r, fromAddr, nil)
+}
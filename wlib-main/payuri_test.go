@@ -0,0 +1,48 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestPaymentURI(t *testing.T) {
+	var out wlib.PaymentURIOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.GenPaymentURI("t01234", "1.5", "", "", "Coffee Shop", "order 42")), &out))
+	require.Empty(t, out.Err)
+	require.Equal(t, "filecoin:t01234?label=Coffee%20Shop&message=order%2042&value=1.5", out.URI)
+	require.Equal(t, "1500000000000000000", out.Value)
+
+	var dec wlib.PaymentURIOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DecodePaymentURI(out.URI, "f01001")), &dec))
+	require.Empty(t, dec.Err)
+	require.Equal(t, "Coffee Shop", dec.Label)
+	require.Equal(t, "1500000000000000000", dec.Msg.Value)
+	require.Equal(t, "t01001", dec.Msg.From)
+	require.Equal(t, "t01234", dec.Msg.To)
+	require.Zero(t, dec.Msg.GasLimit)
+
+	r, err := wlib.ParsePaymentURI("FILECOIN://t01234?method=2&params=gA%3D%3D&foo=bar")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, r.Method)
+	require.Equal(t, []byte{0x80}, r.Params)
+	require.Equal(t, "filecoin:t01234?method=2&params=gA%3D%3D", r.String())
+
+	for _, bad := range []string{
+		"bitcoin:t01234",
+		"filecoin:notanaddress",
+		"filecoin:f01234",
+		"filecoin:t01234?value=-1",
+		"filecoin:t01234?value=1&value=2",
+		"filecoin:t01234?req-expiry=100",
+	} {
+		_, err := wlib.ParsePaymentURI(bad)
+		require.Error(t, err, bad)
+	}
+
+	var bad wlib.PaymentURIOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.GenPaymentURI("f01234", "1", "", "", "", "")), &bad))
+	require.Contains(t, bad.Err, "not on the current network")
+}
@@ -0,0 +1,380 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/ipfs/go-cid"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// 离线签名的二维码格式。联网的机器生成未签名消息，离线的机器扫码签名后
+// 再用二维码返回签名。每个二维码是一个分片
+//
+//	FIL:<类型>/<序号>-<总数>/<CRC32>/<分片 CRC32>/<base45 数据>
+//
+// 类型为 MSG（cbor 编码的 Message）或 SIG（cbor 编码的 QRSignature），
+// CRC32 是整个负载的校验和（8 位大写十六进制），同一序列的分片相同，用来
+// 识别序列并在拼接后校验。分片 CRC32 是 "<序号>-<总数>/" 加上分片数据的
+// 校验和，扫到损坏的分片时立即报错。整个字符串都在二维码字母数字模式的字符集内
+
+const (
+	QRTypeMessage   = "MSG"
+	QRTypeSignature = "SIG"
+
+	qrPrefix = "FIL:"
+
+	// QRFragmentSize 每个分片默认的负载字节数，base45 后约 600 个字符
+	QRFragmentSize = 400
+)
+
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+var base45Index = func() [256]int {
+	var idx [256]int
+	for i := range idx {
+		idx[i] = -1
+	}
+	for i := 0; i < len(base45Alphabet); i++ {
+		idx[base45Alphabet[i]] = i
+	}
+	return idx
+}()
+
+// base45Encode 按 RFC 9285 编码
+func base45Encode(b []byte) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(b); i += 2 {
+		n := int(b[i])<<8 | int(b[i+1])
+		sb.WriteByte(base45Alphabet[n%45])
+		sb.WriteByte(base45Alphabet[n/45%45])
+		sb.WriteByte(base45Alphabet[n/45/45])
+	}
+	if len(b)%2 == 1 {
+		n := int(b[len(b)-1])
+		sb.WriteByte(base45Alphabet[n%45])
+		sb.WriteByte(base45Alphabet[n/45])
+	}
+	return sb.String()
+}
+
+func base45Decode(s string) ([]byte, error) {
+	if len(s)%3 == 1 {
+		return nil, xerrors.Errorf("invalid base45 length %d", len(s))
+	}
+
+	out := make([]byte, 0, len(s)/3*2+1)
+	for i := 0; i < len(s); i += 3 {
+		n, mul := 0, 1
+		end := i + 3
+		if end > len(s) {
+			end = len(s)
+		}
+		for j := i; j < end; j++ {
+			d := base45Index[s[j]]
+			if d < 0 {
+				return nil, xerrors.Errorf("invalid base45 character %q", s[j])
+			}
+			n += d * mul
+			mul *= 45
+		}
+		if end-i == 3 {
+			if n > 0xffff {
+				return nil, xerrors.Errorf("invalid base45 chunk %q", s[i:end])
+			}
+			out = append(out, byte(n>>8), byte(n))
+		} else {
+			if n > 0xff {
+				return nil, xerrors.Errorf("invalid base45 chunk %q", s[i:end])
+			}
+			out = append(out, byte(n))
+		}
+	}
+	return out, nil
+}
+
+// EncodeQRParts 把负载切成分片，size 为每个分片的负载字节数，<= 0 时使用 QRFragmentSize
+func EncodeQRParts(typ string, payload []byte, size int) []string {
+	if size <= 0 {
+		size = QRFragmentSize
+	}
+	total := (len(payload) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	sum := crc32.ChecksumIEEE(payload)
+
+	parts := make([]string, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		data := payload[i*size : end]
+		parts = append(parts, fmt.Sprintf("%s%s/%d-%d/%08X/%08X/%s", qrPrefix, typ, i+1, total, sum,
+			partChecksum(i+1, total, data), base45Encode(data)))
+	}
+	return parts
+}
+
+func partChecksum(seq, total int, data []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE([]byte(fmt.Sprintf("%d-%d/", seq, total))), crc32.IEEETable, data)
+}
+
+type qrPart struct {
+	typ      string
+	seq      int
+	total    int
+	checksum string
+	data     []byte
+}
+
+func parseQRPart(s string) (*qrPart, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToUpper(s), qrPrefix) {
+		return nil, xerrors.Errorf("not a wlib qr code")
+	}
+
+	fields := strings.SplitN(s[len(qrPrefix):], "/", 5)
+	if len(fields) != 5 {
+		return nil, xerrors.Errorf("invalid qr code: expect 5 fields")
+	}
+
+	p := &qrPart{typ: strings.ToUpper(fields[0]), checksum: strings.ToUpper(fields[2])}
+	if p.typ != QRTypeMessage && p.typ != QRTypeSignature {
+		return nil, xerrors.Errorf("unknown qr payload type %q", fields[0])
+	}
+	seq := strings.SplitN(fields[1], "-", 2)
+	if len(seq) != 2 {
+		return nil, xerrors.Errorf("invalid sequence %q", fields[1])
+	}
+	var err error
+	if p.seq, err = strconv.Atoi(seq[0]); err != nil {
+		return nil, xerrors.Errorf("invalid sequence %q", fields[1])
+	}
+	if p.total, err = strconv.Atoi(seq[1]); err != nil {
+		return nil, xerrors.Errorf("invalid sequence %q", fields[1])
+	}
+	if p.total < 1 || p.seq < 1 || p.seq > p.total {
+		return nil, xerrors.Errorf("invalid sequence %q", fields[1])
+	}
+	if len(p.checksum) != 8 {
+		return nil, xerrors.Errorf("invalid checksum %q", fields[2])
+	}
+	if p.data, err = base45Decode(fields[4]); err != nil {
+		return nil, xerrors.Errorf("part %d: %v", p.seq, err)
+	}
+	if sum := fmt.Sprintf("%08X", partChecksum(p.seq, p.total, p.data)); sum != strings.ToUpper(fields[3]) {
+		return nil, xerrors.Errorf("part %d: checksum mismatch: got %s, expect %s", p.seq, sum, strings.ToUpper(fields[3]))
+	}
+	return p, nil
+}
+
+// QRDecoder 拼接扫描到的分片，顺序任意，重复扫到相同的分片会被忽略，
+// 同一序号内容不同时报错
+type QRDecoder struct {
+	mu       sync.Mutex
+	typ      string
+	total    int
+	checksum string
+	parts    map[int][]byte
+}
+
+func NewQRDecoder() *QRDecoder {
+	return &QRDecoder{}
+}
+
+// add 返回是否已经收齐
+func (d *QRDecoder) add(s string) (bool, error) {
+	p, err := parseQRPart(s)
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.parts == nil {
+		d.typ, d.total, d.checksum = p.typ, p.total, p.checksum
+		d.parts = map[int][]byte{}
+	} else if p.typ != d.typ || p.total != d.total || p.checksum != d.checksum {
+		return false, xerrors.Errorf("qr code belongs to another sequence (%s %d parts %s, expect %s %d parts %s)",
+			p.typ, p.total, p.checksum, d.typ, d.total, d.checksum)
+	}
+	if old, ok := d.parts[p.seq]; ok {
+		if !bytes.Equal(old, p.data) {
+			return false, xerrors.Errorf("part %d conflicts with the one already received", p.seq)
+		}
+	} else {
+		d.parts[p.seq] = p.data
+	}
+	return len(d.parts) == d.total, nil
+}
+
+// payload 在收齐后拼接并校验
+func (d *QRDecoder) payload() (string, []byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.parts == nil || len(d.parts) < d.total {
+		return "", nil, xerrors.Errorf("incomplete qr sequence: %d of %d parts", len(d.parts), d.total)
+	}
+
+	var buf bytes.Buffer
+	for i := 1; i <= d.total; i++ {
+		buf.Write(d.parts[i])
+	}
+	if sum := fmt.Sprintf("%08X", crc32.ChecksumIEEE(buf.Bytes())); sum != d.checksum {
+		return "", nil, xerrors.Errorf("checksum mismatch: got %s, expect %s", sum, d.checksum)
+	}
+	return d.typ, buf.Bytes(), nil
+}
+
+// Reset 丢弃已收到的分片，开始新的序列
+func (d *QRDecoder) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.typ, d.total, d.checksum, d.parts = "", 0, "", nil
+}
+
+// QRSignature 是离线机器返回的签名，Cid 用于与联网机器上的消息对应
+type QRSignature struct {
+	Cid       cid.Cid
+	Signature crypto.Signature
+}
+
+func (t *QRSignature) MarshalCBOR(w io.Writer) error {
+	if err := cborWriteArrayHeader(w, 2); err != nil {
+		return err
+	}
+	if err := cbg.WriteCid(w, t.Cid); err != nil {
+		return err
+	}
+	return t.Signature.MarshalCBOR(w)
+}
+
+func (t *QRSignature) UnmarshalCBOR(r io.Reader) error {
+	br := cbg.GetPeeker(r)
+	if err := cborReadTuple(br, 2); err != nil {
+		return err
+	}
+	c, err := cbg.ReadCid(br)
+	if err != nil {
+		return xerrors.Errorf("failed to read cid: %v", err)
+	}
+	t.Cid = c
+	return t.Signature.UnmarshalCBOR(br)
+}
+
+// QROut 是二维码相关函数的输出
+type QROut struct {
+	Err      string   `json:"err,omitempty"`
+	Parts    []string `json:"parts,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Received int      `json:"received,omitempty"`
+	Total    int      `json:"total,omitempty"`
+	Complete bool     `json:"complete"`
+	// MSG 的内容
+	Message *Msg `json:"message,omitempty"`
+	// MSG 时为消息的 cid，SIG 时为被签名消息的 cid
+	Cid       string `json:"cid,omitempty"`
+	SigType   int    `json:"sig_type,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+func qrOut(o *QROut, err error) string {
+	if err != nil {
+		o = &QROut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// EncodeMessageQR 把未签名消息（json 或 base64 cbor）编码为二维码分片
+// size 为每个分片的字节数，0 使用默认值
+// 输出 {"parts": ["FIL:MSG/1-2/...", "FIL:MSG/2-2/..."], "total": 2, "cid": "bafy..."}
+func EncodeMessageQR(msg string, size int) string {
+	m, err := parseMsgInput(msg)
+	if err != nil {
+		return qrOut(nil, err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.MarshalCBOR(&buf); err != nil {
+		return qrOut(nil, xerrors.Errorf("failed to serialize message: %v", err))
+	}
+
+	parts := EncodeQRParts(QRTypeMessage, buf.Bytes(), size)
+	return qrOut(&QROut{Parts: parts, Type: QRTypeMessage, Total: len(parts), Cid: m.Cid().String()}, nil)
+}
+
+// EncodeSignatureQR 把离线机器的签名编码为二维码分片
+// msgCid 为被签名消息的 cid，sig 为 base64 签名，sigType 1 为 secp256k1，2 为 bls
+func EncodeSignatureQR(msgCid string, sigType int, sig string, size int) string {
+	c, err := cid.Decode(msgCid)
+	if err != nil {
+		return qrOut(nil, xerrors.Errorf("invalid cid(%s): %v", msgCid, err))
+	}
+	data, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return qrOut(nil, xerrors.Errorf("invalid signature: %v", err))
+	}
+
+	var buf bytes.Buffer
+	qs := &QRSignature{Cid: c, Signature: crypto.Signature{Type: crypto.SigType(sigType), Data: data}}
+	if err := qs.MarshalCBOR(&buf); err != nil {
+		return qrOut(nil, xerrors.Errorf("failed to serialize signature: %v", err))
+	}
+
+	parts := EncodeQRParts(QRTypeSignature, buf.Bytes(), size)
+	return qrOut(&QROut{Parts: parts, Type: QRTypeSignature, Total: len(parts), Cid: msgCid}, nil)
+}
+
+// Add 加入扫描到的一个分片，收齐后输出解码的内容
+// 未收齐时输出 {"type": "MSG", "received": 1, "total": 3, "complete": false}
+// 收齐 MSG 输出 {"complete": true, "message": {...}, "cid": "bafy..."}
+// 收齐 SIG 输出 {"complete": true, "cid": "bafy...", "sig_type": 1, "signature": "base64"}
+func (d *QRDecoder) Add(part string) string {
+	complete, err := d.add(part)
+	if err != nil {
+		return qrOut(nil, err)
+	}
+	if !complete {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return qrOut(&QROut{Type: d.typ, Received: len(d.parts), Total: d.total}, nil)
+	}
+
+	typ, payload, err := d.payload()
+	if err != nil {
+		return qrOut(nil, err)
+	}
+	o := &QROut{Type: typ, Complete: true}
+
+	switch typ {
+	case QRTypeMessage:
+		var m Message
+		if err := m.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+			return qrOut(nil, xerrors.Errorf("failed to decode message: %v", err))
+		}
+		o.Message = newMsg(&m)
+		o.Cid = m.Cid().String()
+	case QRTypeSignature:
+		var qs QRSignature
+		if err := qs.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+			return qrOut(nil, xerrors.Errorf("failed to decode signature: %v", err))
+		}
+		o.Cid = qs.Cid.String()
+		o.SigType = int(qs.Signature.Type)
+		o.Signature = base64.StdEncoding.EncodeToString(qs.Signature.Data)
+	}
+	return qrOut(o, nil)
+}
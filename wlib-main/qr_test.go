@@ -0,0 +1,82 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestQRRoundTrip(t *testing.T) {
+	// a multisig proposal with large params needs several codes
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(feeMsg), &msg))
+	msg["method"] = 2
+	msg["params"] = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("params", 200)))
+	b, err := json.Marshal(msg)
+	require.NoError(t, err)
+
+	var enc wlib.QROut
+	require.NoError(t, json.Unmarshal([]byte(wlib.EncodeMessageQR(string(b), 0)), &enc))
+	require.Empty(t, enc.Err)
+	require.Equal(t, 4, enc.Total)
+	for _, p := range enc.Parts {
+		require.True(t, strings.HasPrefix(p, "FIL:MSG/"))
+		require.Empty(t, strings.Trim(p, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"))
+	}
+
+	// scanned out of order, with a duplicate
+	d := wlib.NewQRDecoder()
+	var out wlib.QROut
+	for _, i := range []int{2, 0, 2, 3} {
+		require.NoError(t, json.Unmarshal([]byte(d.Add(enc.Parts[i])), &out))
+		require.Empty(t, out.Err)
+		require.False(t, out.Complete)
+	}
+	require.Equal(t, 3, out.Received)
+	require.NoError(t, json.Unmarshal([]byte(d.Add(enc.Parts[1])), &out))
+	require.True(t, out.Complete)
+	require.Equal(t, enc.Cid, out.Cid)
+	require.Equal(t, msg["params"], out.Message.Params)
+
+	// the signature goes back the other way
+	sig := base64.StdEncoding.EncodeToString(make([]byte, 65))
+	require.NoError(t, json.Unmarshal([]byte(wlib.EncodeSignatureQR(out.Cid, 1, sig, 0)), &enc))
+	require.Len(t, enc.Parts, 1)
+
+	d = wlib.NewQRDecoder()
+	require.NoError(t, json.Unmarshal([]byte(d.Add(enc.Parts[0])), &out))
+	require.True(t, out.Complete)
+	require.Equal(t, wlib.QRTypeSignature, out.Type)
+	require.Equal(t, 1, out.SigType)
+	require.Equal(t, sig, out.Signature)
+}
+
+func TestQRDecoderErrors(t *testing.T) {
+	a := wlib.EncodeQRParts(wlib.QRTypeMessage, []byte(strings.Repeat("a", 30)), 10)
+	b := wlib.EncodeQRParts(wlib.QRTypeMessage, []byte(strings.Repeat("b", 30)), 10)
+
+	d := wlib.NewQRDecoder()
+	require.Contains(t, d.Add(a[0]), `"complete":false`)
+	require.Contains(t, d.Add(b[1]), "another sequence")
+	require.Contains(t, d.Add("hello"), "not a wlib qr code")
+
+	// a corrupt part is reported as soon as it is scanned
+	fields := strings.SplitN(a[2], "/", 5)
+	fields[4] = strings.Replace(fields[4], fields[4][:3], "000", 1)
+	require.Contains(t, d.Add(a[1]), `"complete":false`)
+	require.Contains(t, d.Add(strings.Join(fields, "/")), "part 3: checksum mismatch")
+
+	// so is a part whose sequence number was altered
+	fields = strings.SplitN(a[2], "/", 5)
+	fields[1] = "1-3"
+	require.Contains(t, d.Add(strings.Join(fields, "/")), "part 1: checksum mismatch")
+
+	// a repeated part is ignored, a different one with the same sequence is an error
+	require.Contains(t, d.Add(a[1]), `"received":2`)
+	forged := append(strings.SplitN(a[1], "/", 5)[:3], strings.SplitN(b[1], "/", 5)[3:]...)
+	require.Contains(t, d.Add(strings.Join(forged, "/")), "part 2 conflicts")
+}
@@ -0,0 +1,187 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	"golang.org/x/xerrors"
+)
+
+// 替换交易（replace-by-fee）的规则与 lotus messagepool 一致：
+// 新消息的 GasPremium 至少为旧的 125%（按 1/256 取整）再加 1
+const (
+	ReplaceByFeePercentageMinimum = 125
+
+	rbfDenom = 256
+)
+
+var rbfNum = NewInt((ReplaceByFeePercentageMinimum - 100) * rbfDenom / 100)
+
+// ComputeMinRBF 替换旧消息所需的最小 GasPremium
+func ComputeMinRBF(curPrem BigInt) BigInt {
+	minPrice := BigAdd(curPrem, BigDiv(BigMul(curPrem, rbfNum), NewInt(rbfDenom)))
+	return BigAdd(minPrice, NewInt(1))
+}
+
+// parseMsgInput 解析 Msg json，或 base64 编码的 cbor 消息（Message 或 SignedMessage）
+func parseMsgInput(s string) (*Message, error) {
+	if strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return parseMsg(s)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("message is neither json nor base64 cbor: %v", err)
+	}
+
+	var msg Message
+	if err := msg.UnmarshalCBOR(bytes.NewReader(b)); err == nil {
+		return &msg, nil
+	}
+
+	var smsg SignedMessage
+	if err := smsg.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return nil, xerrors.Errorf("failed to decode cbor message: %v", err)
+	}
+	return &smsg.Message, nil
+}
+
+// parseMaxFee 只有空字符串表示不限制，"0" 无法替换任何消息，按错误处理
+func parseMaxFee(maxFee string) (BigInt, error) {
+	if maxFee == "" {
+		return EmptyInt, nil
+	}
+
+	mf, err := BigFromString(maxFee)
+	if err != nil || mf.Sign() < 0 {
+		return EmptyInt, xerrors.Errorf("invalid max fee: %s", maxFee)
+	}
+	if mf.IsZero() {
+		return EmptyInt, xerrors.Errorf("max fee must be positive, leave it empty for no limit")
+	}
+	return mf, nil
+}
+
+// replaceGas 把 replacement 的 gas 参数调整到可以替换 old，maxFee 为空时不限制
+func replaceGas(replacement, old *Message, maxFee BigInt) error {
+	if err := old.checkGas(); err != nil {
+		return err
+	}
+
+	minPremium := ComputeMinRBF(old.GasPremium)
+	if replacement.GasPremium.LessThan(minPremium) {
+		replacement.GasPremium = minPremium
+	}
+	if replacement.GasFeeCap.LessThan(replacement.GasPremium) {
+		replacement.GasFeeCap = replacement.GasPremium
+	}
+
+	if maxFee.Int == nil {
+		return nil
+	}
+
+	gl := NewInt(uint64(replacement.GasLimit))
+	if replacement.MaxFee().GreaterThan(maxFee) {
+		replacement.GasFeeCap = BigDiv(maxFee, gl)
+		if replacement.GasPremium.GreaterThan(replacement.GasFeeCap) {
+			replacement.GasPremium = replacement.GasFeeCap
+		}
+	}
+	if replacement.GasPremium.LessThan(minPremium) {
+		return xerrors.Errorf("max fee %s is too low to replace the message, need at least %s",
+			FIL(maxFee).Short(), FIL(BigMul(minPremium, gl)).Short())
+	}
+
+	return nil
+}
+
+type ReplaceOut struct {
+	Err            string `json:"err,omitempty"`
+	Message        *Msg   `json:"message,omitempty"`
+	Cid            string `json:"cid,omitempty"`
+	SigningPayload []byte `json:"signing_payload,omitempty"`
+	MinPremium     string `json:"min_premium,omitempty"`
+	MaxFee         string `json:"max_fee,omitempty"`
+}
+
+func replaceOut(m *Message, old *Message, err error) string {
+	o := &ReplaceOut{}
+	if err == nil {
+		o.Message = newMsg(m)
+		var b []byte
+		if b, err = json.Marshal(o.Message); err == nil {
+			o.Cid = GenCid(string(b))
+			o.SigningPayload = m.Cid().Bytes()
+			o.MinPremium = ComputeMinRBF(old.GasPremium).String()
+			o.MaxFee = FIL(m.MaxFee()).Short()
+		}
+	}
+	if err != nil {
+		o = &ReplaceOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// ReplaceByFee 加速卡在消息池中的消息：相同 nonce，GasPremium 至少提高 25%，
+// GasFeeCap 不低于新的 GasPremium
+// msg 为 Msg json 或 base64 cbor 消息，maxFee（attoFIL）为空则不限制最大手续费
+// 输出 {"message": {...}, "cid": "bafy...", "signing_payload": "base64", "min_premium": "...", "max_fee": "1.2 mFIL"}
+func ReplaceByFee(msg, maxFee string) string {
+	old, err := parseMsgInput(msg)
+	if err != nil {
+		return replaceOut(nil, nil, err)
+	}
+
+	mf, err := parseMaxFee(maxFee)
+	if err != nil {
+		return replaceOut(nil, nil, err)
+	}
+
+	replacement := *old
+	if err := replaceGas(&replacement, old, mf); err != nil {
+		return replaceOut(nil, nil, err)
+	}
+
+	return replaceOut(&replacement, old, nil)
+}
+
+// CancelMessage 取消卡在消息池中的消息：用相同的 From/Nonce 发送 0 FIL 给自己，
+// gas 参数满足替换规则
+// msg 为 Msg json 或 base64 cbor 消息，maxFee（attoFIL）为空则不限制最大手续费
+// 输出同 ReplaceByFee，signing_payload 为需要签名的数据
+func CancelMessage(msg, maxFee string) string {
+	old, err := parseMsgInput(msg)
+	if err != nil {
+		return replaceOut(nil, nil, err)
+	}
+
+	mf, err := parseMaxFee(maxFee)
+	if err != nil {
+		return replaceOut(nil, nil, err)
+	}
+	if mf.Int != nil && old.MaxFee().GreaterThan(mf) {
+		return replaceOut(nil, nil, xerrors.Errorf("original message max fee %s already exceeds the limit %s",
+			FIL(old.MaxFee()).Short(), FIL(mf).Short()))
+	}
+
+	cancel := &Message{
+		Version:    old.Version,
+		To:         old.From,
+		From:       old.From,
+		Nonce:      old.Nonce,
+		Value:      NewInt(0),
+		GasLimit:   old.GasLimit,
+		GasFeeCap:  old.GasFeeCap,
+		GasPremium: old.GasPremium,
+		Method:     builtin5.MethodSend,
+	}
+	if err := replaceGas(cancel, old, mf); err != nil {
+		return replaceOut(nil, nil, err)
+	}
+
+	return replaceOut(cancel, old, nil)
+}
@@ -0,0 +1,77 @@
+package wlib_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestReplaceByFee(t *testing.T) {
+	var o wlib.ReplaceOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.ReplaceByFee(feeMsg, "")), &o))
+	require.Equal(t, "", o.Err)
+	require.Equal(t, "125001", o.Message.GasPremium)
+	require.Equal(t, "200000", o.Message.GasFeeCap)
+	require.Equal(t, uint64(1), o.Message.Nonce)
+
+	payload, err := json.Marshal(o.Message)
+	require.NoError(t, err)
+	require.Equal(t, wlib.GenCid(string(payload)), o.Cid)
+	require.NotEqual(t, wlib.GenCid(feeMsg), o.Cid)
+
+	// capped by max fee, the fee cap drops but still covers the premium
+	require.NoError(t, json.Unmarshal([]byte(wlib.ReplaceByFee(feeMsg, "150000000000")), &o))
+	require.Equal(t, "", o.Err)
+	require.Equal(t, "150000", o.Message.GasFeeCap)
+
+	o = wlib.ReplaceOut{}
+	require.NoError(t, json.Unmarshal([]byte(wlib.ReplaceByFee(feeMsg, "120000000000")), &o))
+	require.Contains(t, o.Err, "too low")
+
+	o = wlib.ReplaceOut{}
+	require.NoError(t, json.Unmarshal([]byte(wlib.ReplaceByFee(feeMsg, "0")), &o))
+	require.Contains(t, o.Err, "must be positive")
+}
+
+func TestReplaceByFeeCBOR(t *testing.T) {
+	to, _ := address.NewIDAddress(1000)
+	m := &wlib.Message{
+		To:         to,
+		From:       to,
+		Nonce:      1,
+		Value:      wlib.NewInt(0),
+		GasLimit:   1000000,
+		GasFeeCap:  wlib.NewInt(200000),
+		GasPremium: wlib.NewInt(100000),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, m.MarshalCBOR(&buf))
+
+	var o wlib.ReplaceOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.ReplaceByFee(base64.StdEncoding.EncodeToString(buf.Bytes()), "")), &o))
+	require.Equal(t, "", o.Err)
+	require.Equal(t, "01000", o.Message.To[1:])
+	require.Equal(t, "125001", o.Message.GasPremium)
+}
+
+func TestCancelMessage(t *testing.T) {
+	var o wlib.ReplaceOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.CancelMessage(feeMsg, "")), &o))
+	require.Equal(t, "", o.Err)
+	require.Equal(t, o.Message.From, o.Message.To)
+	require.Equal(t, "0", o.Message.Value)
+	require.Equal(t, uint64(0), o.Message.Method)
+	require.Equal(t, uint64(1), o.Message.Nonce)
+	require.Equal(t, "125001", o.Message.GasPremium)
+	require.NotEmpty(t, o.SigningPayload)
+
+	o = wlib.ReplaceOut{}
+	require.NoError(t, json.Unmarshal([]byte(wlib.CancelMessage(feeMsg, "150000000000")), &o))
+	require.Contains(t, o.Err, "already exceeds")
+}
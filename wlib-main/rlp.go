@@ -0,0 +1,163 @@
+package wlib
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"golang.org/x/xerrors"
+)
+
+// Recursive Length Prefix encoding, as used by Ethereum, see
+// https://ethereum.org/en/developers/docs/data-structures-and-encoding/rlp/
+
+func rlpLength(offset byte, n int) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	l := trimLeadingZeros(buf[:])
+	return append([]byte{offset + 55 + byte(len(l))}, l...)
+}
+
+func trimLeadingZeros(b []byte) []byte {
+	for i := range b {
+		if b[i] != 0 {
+			return b[i:]
+		}
+	}
+	return nil
+}
+
+// rlpEncodeBytes encodes b as an RLP string.
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpLength(0x80, len(b)), b...)
+}
+
+// rlpEncodeUint encodes n as a big-endian RLP string without leading zeros.
+func rlpEncodeUint(n uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return rlpEncodeBytes(trimLeadingZeros(buf[:]))
+}
+
+// rlpEncodeList wraps already encoded items in an RLP list.
+func rlpEncodeList(items ...[]byte) []byte {
+	n := 0
+	for _, it := range items {
+		n += len(it)
+	}
+
+	out := rlpLength(0xc0, n)
+	for _, it := range items {
+		out = append(out, it...)
+	}
+	return out
+}
+
+// rlpEncodeBig encodes a non-negative integer; RLP has no negative numbers.
+func rlpEncodeBig(n BigInt) ([]byte, error) {
+	if n.Int == nil {
+		return rlpEncodeBytes(nil), nil
+	}
+	if n.Sign() < 0 {
+		return nil, xerrors.Errorf("rlp: cannot encode negative integer %s", n)
+	}
+	return rlpEncodeBytes(n.Int.Bytes()), nil
+}
+
+// rlpDecode decodes one item from b, returning it and the remaining bytes.
+// Strings decode to []byte and lists to []interface{}.
+func rlpDecode(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, xerrors.Errorf("rlp: unexpected end of input")
+	}
+
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		return b[:1], b[1:], nil
+	case prefix < 0xc0:
+		data, rest, err := rlpPayload(b, 0x80)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) == 1 && data[0] < 0x80 {
+			return nil, nil, xerrors.Errorf("rlp: non-canonical single byte string")
+		}
+		return data, rest, nil
+	default:
+		data, rest, err := rlpPayload(b, 0xc0)
+		if err != nil {
+			return nil, nil, err
+		}
+		items := []interface{}{}
+		for len(data) > 0 {
+			var it interface{}
+			if it, data, err = rlpDecode(data); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, it)
+		}
+		return items, rest, nil
+	}
+}
+
+func rlpPayload(b []byte, offset byte) ([]byte, []byte, error) {
+	short := int(b[0] - offset)
+	if short < 56 {
+		if len(b) < 1+short {
+			return nil, nil, xerrors.Errorf("rlp: item of length %d exceeds input", short)
+		}
+		return b[1 : 1+short], b[1+short:], nil
+	}
+
+	ll := short - 55
+	if len(b) < 1+ll || b[1] == 0 {
+		return nil, nil, xerrors.Errorf("rlp: invalid length prefix")
+	}
+	var buf [8]byte
+	copy(buf[8-ll:], b[1:1+ll])
+	n := binary.BigEndian.Uint64(buf[:])
+	if n < 56 || n > uint64(len(b)-1-ll) {
+		return nil, nil, xerrors.Errorf("rlp: invalid length %d", n)
+	}
+	return b[1+ll : 1+ll+int(n)], b[1+ll+int(n):], nil
+}
+
+func rlpBytes(it interface{}) ([]byte, error) {
+	b, ok := it.([]byte)
+	if !ok {
+		return nil, xerrors.Errorf("rlp: expected string, got list")
+	}
+	return b, nil
+}
+
+func rlpBig(it interface{}) (BigInt, error) {
+	b, err := rlpBytes(it)
+	if err != nil {
+		return EmptyInt, err
+	}
+	if len(b) > 0 && b[0] == 0 {
+		return EmptyInt, xerrors.Errorf("rlp: integer has leading zeros")
+	}
+	if len(b) > 32 {
+		return EmptyInt, xerrors.Errorf("rlp: integer larger than 256 bits")
+	}
+	return BigInt{Int: new(big.Int).SetBytes(b)}, nil
+}
+
+func rlpUint(it interface{}) (uint64, error) {
+	n, err := rlpBig(it)
+	if err != nil {
+		return 0, err
+	}
+	if !n.IsUint64() {
+		return 0, xerrors.Errorf("rlp: integer overflows uint64")
+	}
+	return n.Uint64(), nil
+}
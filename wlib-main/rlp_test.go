@@ -0,0 +1,34 @@
+package wlib
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// examples from https://ethereum.org/en/developers/docs/data-structures-and-encoding/rlp/
+func TestRLPEncode(t *testing.T) {
+	empty := rlpEncodeList()
+	for want, got := range map[string][]byte{
+		"83646f67":           rlpEncodeBytes([]byte("dog")),
+		"c88363617483646f67": rlpEncodeList(rlpEncodeBytes([]byte("cat")), rlpEncodeBytes([]byte("dog"))),
+		"80":                 rlpEncodeBytes(nil),
+		"c0":                 empty,
+		"0f":                 rlpEncodeUint(15),
+		"820400":             rlpEncodeUint(1024),
+		"c7c0c1c0c3c0c1c0":   rlpEncodeList(empty, rlpEncodeList(empty), rlpEncodeList(empty, rlpEncodeList(empty))),
+		"b8384c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c6974": rlpEncodeBytes([]byte("Lorem ipsum dolor sit amet, consectetur adipisicing elit")),
+	} {
+		require.Equal(t, want, hex.EncodeToString(got))
+	}
+
+	b, err := rlpEncodeBig(BigInt{Int: big.NewInt(0)})
+	require.NoError(t, err)
+	require.Equal(t, "80", hex.EncodeToString(b))
+	_, err = rlpEncodeBig(BigInt{Int: big.NewInt(-1)})
+	require.Error(t, err)
+
+	require.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", hex.EncodeToString(keccak256(nil)))
+}
@@ -0,0 +1,352 @@
+package wlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Client 是 lotus JSON-RPC 2.0 的最小客户端，只包含钱包需要的 Filecoin.* 方法
+type Client struct {
+	endpoint string
+	token    string
+	http     *http.Client
+	id       int64
+}
+
+// NewClient endpoint 如 http://127.0.0.1:1234/rpc/v1，token 为空时不带 Authorization
+func NewClient(endpoint, token string) *Client {
+	return &Client{
+		endpoint: endpoint,
+		token:    token,
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type rpcRequest struct {
+	Jsonrpc string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      int64           `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// RPCError 是节点返回的 JSON-RPC 错误
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// Call 调用任意方法，result 为 nil 时丢弃返回值
+func (c *Client) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(&rpcRequest{
+		Jsonrpc: "2.0",
+		ID:      atomic.AddInt64(&c.id, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to marshal %s params: %v", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return xerrors.Errorf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return xerrors.Errorf("%s: failed to read response: %v", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("%s: http status %d: %s", method, resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	var r rpcResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return xerrors.Errorf("%s: invalid response: %v", method, err)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, result); err != nil {
+		return xerrors.Errorf("%s: failed to decode result: %v", method, err)
+	}
+	return nil
+}
+
+// Actor 是 StateGetActor 的返回
+type Actor struct {
+	Code    cid.Cid
+	Head    cid.Cid
+	Nonce   uint64
+	Balance abi.TokenAmount
+}
+
+// MessageReceipt 消息执行结果
+type MessageReceipt struct {
+	ExitCode exitcode.ExitCode
+	Return   []byte
+	GasUsed  int64
+}
+
+// MsgLookup 是 StateSearchMsg 的返回，Message 为实际上链的消息（可能是替换后的）
+type MsgLookup struct {
+	Message cid.Cid
+	Receipt MessageReceipt
+	TipSet  []cid.Cid
+	Height  abi.ChainEpoch
+}
+
+// TipSet 只保留钱包需要的字段
+type TipSet struct {
+	Cids   []cid.Cid
+	Height abi.ChainEpoch
+}
+
+type messageSendSpec struct {
+	MaxFee abi.TokenAmount
+}
+
+// ErrActorNotFound 表示地址还没有上链，StateGetActor、StateLookupID 和
+// StateAccountKey 返回的错误可以用 xerrors.Is 判断
+var ErrActorNotFound = xerrors.New("actor not found")
+
+// rpcCodeActorNotFound 是 lotus api.EActorNotFound
+const rpcCodeActorNotFound = 3
+
+// actorNotFound 把节点的 actor not found 错误转换为 ErrActorNotFound，
+// 旧版本 lotus 没有错误码，只能按内容判断
+func actorNotFound(err error) error {
+	var rerr *RPCError
+	if !xerrors.As(err, &rerr) {
+		return err
+	}
+	if rerr.Code == rpcCodeActorNotFound || strings.Contains(rerr.Message, ErrActorNotFound.Error()) {
+		return xerrors.Errorf("%s: %w", rerr.Message, ErrActorNotFound)
+	}
+	return err
+}
+
+func (c *Client) callAddress(ctx context.Context, method string, addr address.Address) (address.Address, error) {
+	var s string
+	if err := c.Call(ctx, method, &s, addr.String(), nil); err != nil {
+		return address.Undef, actorNotFound(err)
+	}
+	return address.NewFromString(s)
+}
+
+func (c *Client) MpoolGetNonce(ctx context.Context, addr address.Address) (uint64, error) {
+	var nonce uint64
+	err := c.Call(ctx, "Filecoin.MpoolGetNonce", &nonce, addr.String())
+	return nonce, err
+}
+
+// GasEstimateMessageGas 估算 GasLimit / GasFeeCap / GasPremium，maxFee 为空时使用节点默认值
+func (c *Client) GasEstimateMessageGas(ctx context.Context, msg *Message, maxFee abi.TokenAmount) (*Message, error) {
+	var spec *messageSendSpec
+	if maxFee.Int != nil {
+		spec = &messageSendSpec{MaxFee: maxFee}
+	}
+
+	var out Message
+	if err := c.Call(ctx, "Filecoin.GasEstimateMessageGas", &out, msg, spec, nil); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) MpoolPush(ctx context.Context, sm *SignedMessage) (cid.Cid, error) {
+	var out cid.Cid
+	err := c.Call(ctx, "Filecoin.MpoolPush", &out, sm)
+	return out, err
+}
+
+func (c *Client) StateGetActor(ctx context.Context, addr address.Address) (*Actor, error) {
+	var out Actor
+	if err := c.Call(ctx, "Filecoin.StateGetActor", &out, addr.String(), nil); err != nil {
+		return nil, actorNotFound(err)
+	}
+	return &out, nil
+}
+
+func (c *Client) WalletBalance(ctx context.Context, addr address.Address) (abi.TokenAmount, error) {
+	var out abi.TokenAmount
+	err := c.Call(ctx, "Filecoin.WalletBalance", &out, addr.String())
+	return out, err
+}
+
+// StateSearchMsg 查找消息回执，未上链时返回 nil, nil；允许查找被替换后的消息
+func (c *Client) StateSearchMsg(ctx context.Context, msg cid.Cid) (*MsgLookup, error) {
+	var out *MsgLookup
+	if err := c.Call(ctx, "Filecoin.StateSearchMsg", &out, nil, msg, -1, true); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) StateLookupID(ctx context.Context, addr address.Address) (address.Address, error) {
+	return c.callAddress(ctx, "Filecoin.StateLookupID", addr)
+}
+
+func (c *Client) StateAccountKey(ctx context.Context, addr address.Address) (address.Address, error) {
+	return c.callAddress(ctx, "Filecoin.StateAccountKey", addr)
+}
+
+func (c *Client) ChainHead(ctx context.Context) (*TipSet, error) {
+	var out TipSet
+	if err := c.Call(ctx, "Filecoin.ChainHead", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LotusClient 是给 gomobile 用的包装，所有方法返回 json 字符串 {"err": "...", "result": ...}
+type LotusClient struct {
+	c    *Client
+	poll time.Duration
+}
+
+func NewLotusClient(endpoint, token string) *LotusClient {
+	return &LotusClient{c: NewClient(endpoint, token)}
+}
+
+// SetTimeout 设置请求超时（秒）
+func (l *LotusClient) SetTimeout(seconds int) {
+	l.c.http.Timeout = time.Duration(seconds) * time.Second
+}
+
+type RPCOut struct {
+	Err    string      `json:"err,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+func rpcOut(result interface{}, err error) string {
+	o := &RPCOut{Result: result}
+	if err != nil {
+		o = &RPCOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+func (l *LotusClient) withAddress(addr string, fn func(address.Address) (interface{}, error)) string {
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid address(%s): %v", addr, err))
+	}
+	return rpcOut(fn(a))
+}
+
+// MpoolGetNonce 输出 {"result": 12}
+func (l *LotusClient) MpoolGetNonce(addr string) string {
+	return l.withAddress(addr, func(a address.Address) (interface{}, error) {
+		return l.c.MpoolGetNonce(context.Background(), a)
+	})
+}
+
+// GasEstimateMessageGas 传入 Msg json（任意格式），maxFee 为 attoFIL，可为空
+// 输出的 result 为 lotus 格式的消息
+func (l *LotusClient) GasEstimateMessageGas(msg, maxFee string) string {
+	var m Message
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid message json: %v", err))
+	}
+	mf, err := parseMaxFee(maxFee)
+	if err != nil {
+		return rpcOut(nil, err)
+	}
+	return rpcOut(l.c.GasEstimateMessageGas(context.Background(), &m, mf))
+}
+
+// MpoolPush 传入 lotus 格式的签名消息 json（见 LotusSignedMessageJSON），输出 {"result": {"/": "bafy..."}}
+func (l *LotusClient) MpoolPush(signed string) string {
+	var sm SignedMessage
+	if err := json.Unmarshal([]byte(signed), &sm); err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid signed message json: %v", err))
+	}
+	return rpcOut(l.c.MpoolPush(context.Background(), &sm))
+}
+
+func (l *LotusClient) StateGetActor(addr string) string {
+	return l.withAddress(addr, func(a address.Address) (interface{}, error) {
+		return l.c.StateGetActor(context.Background(), a)
+	})
+}
+
+// WalletBalance 输出 {"result": "attoFIL"}
+func (l *LotusClient) WalletBalance(addr string) string {
+	return l.withAddress(addr, func(a address.Address) (interface{}, error) {
+		return l.c.WalletBalance(context.Background(), a)
+	})
+}
+
+// StateSearchMsg 未上链时输出 {}
+func (l *LotusClient) StateSearchMsg(msgCid string) string {
+	c, err := cid.Decode(msgCid)
+	if err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid cid(%s): %v", msgCid, err))
+	}
+	lookup, err := l.c.StateSearchMsg(context.Background(), c)
+	if lookup == nil {
+		return rpcOut(nil, err)
+	}
+	return rpcOut(lookup, err)
+}
+
+func (l *LotusClient) StateLookupID(addr string) string {
+	return l.withAddress(addr, func(a address.Address) (interface{}, error) {
+		id, err := l.c.StateLookupID(context.Background(), a)
+		return id.String(), err
+	})
+}
+
+func (l *LotusClient) StateAccountKey(addr string) string {
+	return l.withAddress(addr, func(a address.Address) (interface{}, error) {
+		key, err := l.c.StateAccountKey(context.Background(), a)
+		return key.String(), err
+	})
+}
+
+func (l *LotusClient) ChainHead() string {
+	return rpcOut(l.c.ChainHead(context.Background()))
+}
@@ -0,0 +1,105 @@
+package wlib_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+	"golang.org/x/xerrors"
+)
+
+type rpcHandler func(params []json.RawMessage) (interface{}, error)
+
+// mockLotus serves the given Filecoin.* methods, rejecting requests without the token.
+func mockLotus(t *testing.T, token string, methods map[string]rpcHandler) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ID     int64
+			Method string
+			Params []json.RawMessage
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if h, ok := methods[req.Method]; !ok {
+			resp["error"] = wlib.RPCError{Code: -32601, Message: "method not found"}
+		} else if res, err := h(req.Params); err != nil {
+			rerr, ok := err.(*wlib.RPCError)
+			if !ok {
+				rerr = &wlib.RPCError{Code: 1, Message: err.Error()}
+			}
+			resp["error"] = rerr
+		} else {
+			resp["result"] = res
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := mockLotus(t, "secret", map[string]rpcHandler{
+		"Filecoin.MpoolGetNonce": func(params []json.RawMessage) (interface{}, error) {
+			assert.Equal(t, `"t01001"`, string(params[0]))
+			return 7, nil
+		},
+		"Filecoin.WalletBalance": func([]json.RawMessage) (interface{}, error) {
+			return "1000", nil
+		},
+		"Filecoin.StateGetActor": func([]json.RawMessage) (interface{}, error) {
+			return nil, &wlib.RPCError{Code: 3, Message: "resolution lookup failed (t01001): actor not found"}
+		},
+		"Filecoin.StateLookupID": func([]json.RawMessage) (interface{}, error) {
+			return "t01001", nil
+		},
+		"Filecoin.StateSearchMsg": func([]json.RawMessage) (interface{}, error) {
+			return nil, nil
+		},
+		"Filecoin.ChainHead": func([]json.RawMessage) (interface{}, error) {
+			return map[string]interface{}{"Cids": []interface{}{}, "Height": 100}, nil
+		},
+	})
+
+	ctx := context.Background()
+	c := wlib.NewClient(srv.URL, "secret")
+	from, _ := address.NewIDAddress(1001)
+
+	nonce, err := c.MpoolGetNonce(ctx, from)
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), nonce)
+
+	head, err := c.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), int64(head.Height))
+
+	_, err = c.StateAccountKey(ctx, from)
+	require.Contains(t, err.Error(), "method not found")
+	require.False(t, xerrors.Is(err, wlib.ErrActorNotFound))
+
+	_, err = c.StateGetActor(ctx, from)
+	require.True(t, xerrors.Is(err, wlib.ErrActorNotFound))
+
+	_, err = wlib.NewClient(srv.URL, "wrong").ChainHead(ctx)
+	require.Contains(t, err.Error(), "401")
+
+	l := wlib.NewLotusClient(srv.URL, "secret")
+	require.JSONEq(t, `{"result": "1000"}`, l.WalletBalance("t01001"))
+	require.JSONEq(t, `{"result": "t01001"}`, l.StateLookupID("t01001"))
+	require.JSONEq(t, `{}`, l.StateSearchMsg(wlib.GenCid(feeMsg)))
+	require.Contains(t, l.MpoolGetNonce("bad"), "invalid address")
+}
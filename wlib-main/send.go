@@ -0,0 +1,336 @@
+package wlib
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/crypto"
+	builtin5 "github.com/filecoin-project/specs-actors/v5/actors/builtin"
+	cid "github.com/ipfs/go-cid"
+	"golang.org/x/xerrors"
+)
+
+// Send 的各个步骤，SendState.Step 记录最后完成的步骤
+const (
+	SendStepNonce     = "nonce"
+	SendStepEstimated = "estimated"
+	SendStepSigned    = "signed"
+	SendStepPushed    = "pushed"
+	SendStepConfirmed = "confirmed"
+)
+
+// Signer 对消息 CID 的字节签名，from 为发送方的公钥地址（f1 / f3）。
+// wlib 内置 secp256k1（NewSecpSigner），BLS 由调用方实现
+type Signer interface {
+	Sign(from string, data []byte) ([]byte, error)
+}
+
+type secpSigner struct {
+	ck []byte
+}
+
+// NewSecpSigner ck 为 base64 编码的私钥
+func NewSecpSigner(ck string) (Signer, error) {
+	b, err := base64.StdEncoding.DecodeString(ck)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid private key: %v", err)
+	}
+	return &secpSigner{ck: b}, nil
+}
+
+func (s *secpSigner) Sign(from string, data []byte) ([]byte, error) {
+	sig, err := secpSign(s.ck, data)
+	if err != nil {
+		return nil, err
+	}
+	return sig.Data, nil
+}
+
+// SendCallback 每完成一步回调一次，state 为 SendState 的 json，
+// App 保存它，被杀掉后用 ResumeSend 继续
+type SendCallback interface {
+	OnProgress(step string, state string)
+}
+
+// SendState 是可以持久化的发送进度
+type SendState struct {
+	Step     string          `json:"step"`
+	Message  *Message        `json:"message"`
+	Signed   *SignedMessage  `json:"signed,omitempty"`
+	Cid      string          `json:"cid,omitempty"`
+	Executed string          `json:"executed,omitempty"`
+	Height   abi.ChainEpoch  `json:"height,omitempty"`
+	Receipt  *MessageReceipt `json:"receipt,omitempty"`
+}
+
+// Sender 执行 nonce -> 估算 gas -> 签名 -> 推送 -> 等待回执
+type Sender struct {
+	Client       *Client
+	Signer       Signer
+	Callback     SendCallback
+	MaxFee       abi.TokenAmount
+	PollInterval time.Duration
+}
+
+func NewSender(c *Client, signer Signer) *Sender {
+	return &Sender{
+		Client:       c,
+		Signer:       signer,
+		PollInterval: 10 * time.Second,
+	}
+}
+
+// capGasFee 与 lotus messagepool.CapGasFee 一致，限制 GasFeeCap * GasLimit 不超过 maxFee
+func capGasFee(m *Message, maxFee abi.TokenAmount) {
+	if maxFee.Int == nil || maxFee.Sign() == 0 || m.GasLimit <= 0 {
+		return
+	}
+	if m.MaxFee().GreaterThan(maxFee) {
+		m.GasFeeCap = BigDiv(maxFee, NewInt(uint64(m.GasLimit)))
+	}
+	if m.GasPremium.GreaterThan(m.GasFeeCap) {
+		m.GasPremium = m.GasFeeCap
+	}
+}
+
+// Send 发送 value（attoFIL）从 from 到 to，阻塞到消息上链或 ctx 结束
+func (s *Sender) Send(ctx context.Context, from, to address.Address, value abi.TokenAmount) (*SendState, error) {
+	st := &SendState{
+		Message: &Message{
+			To:         to,
+			From:       from,
+			Value:      value,
+			GasFeeCap:  NewInt(0),
+			GasPremium: NewInt(0),
+			Method:     builtin5.MethodSend,
+		},
+	}
+	return st, s.Resume(ctx, st)
+}
+
+// Resume 从 st.Step 之后继续执行
+func (s *Sender) Resume(ctx context.Context, st *SendState) error {
+	if st.Message == nil {
+		return xerrors.Errorf("send state has no message")
+	}
+
+	for st.Step != SendStepConfirmed {
+		var next string
+		var err error
+		switch st.Step {
+		case "":
+			st.Message.Nonce, err = s.Client.MpoolGetNonce(ctx, st.Message.From)
+			next = SendStepNonce
+		case SendStepNonce:
+			err = s.estimate(ctx, st)
+			next = SendStepEstimated
+		case SendStepEstimated:
+			err = s.sign(ctx, st)
+			next = SendStepSigned
+		case SendStepSigned:
+			err = s.push(ctx, st)
+			next = SendStepPushed
+		case SendStepPushed:
+			err = s.wait(ctx, st)
+			next = SendStepConfirmed
+		default:
+			return xerrors.Errorf("unknown send step %q", st.Step)
+		}
+		if err != nil {
+			return err
+		}
+
+		st.Step = next
+		s.progress(st)
+	}
+
+	return nil
+}
+
+func (s *Sender) progress(st *SendState) {
+	if s.Callback == nil {
+		return
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	s.Callback.OnProgress(st.Step, string(b))
+}
+
+func (s *Sender) estimate(ctx context.Context, st *SendState) error {
+	m, err := s.Client.GasEstimateMessageGas(ctx, st.Message, s.MaxFee)
+	if err != nil {
+		return err
+	}
+
+	capGasFee(m, s.MaxFee)
+	if err := m.Validate(); err != nil {
+		return xerrors.Errorf("estimated message is invalid: %v", err)
+	}
+
+	st.Message = m
+	return nil
+}
+
+func (s *Sender) sign(ctx context.Context, st *SendState) error {
+	key := st.Message.From
+	if key.Protocol() == address.ID {
+		var err error
+		if key, err = s.Client.StateAccountKey(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	var sigType crypto.SigType
+	switch key.Protocol() {
+	case address.SECP256K1:
+		sigType = crypto.SigTypeSecp256k1
+	case address.BLS:
+		sigType = crypto.SigTypeBLS
+	default:
+		return xerrors.Errorf("unsupported sender %s", key.String())
+	}
+
+	sig, err := s.Signer.Sign(key.String(), st.Message.Cid().Bytes())
+	if err != nil {
+		return xerrors.Errorf("failed to sign message: %v", err)
+	}
+
+	st.Signed = &SignedMessage{
+		Message:   *st.Message,
+		Signature: crypto.Signature{Type: sigType, Data: sig},
+	}
+	st.Cid = st.Signed.Cid().String()
+	return nil
+}
+
+// mpoolErrAlreadyIn 是 lotus 对同一条消息重复推送时的报错片段，完整内容为
+// "message from <from> with nonce <nonce> already in mpool: validation failure"
+const mpoolErrAlreadyIn = "already in mpool"
+
+// push 推送成功后、保存 pushed 之前被杀掉时，ResumeSend 会再次推送，
+// 这时节点返回已在消息池中，或者消息已在消息池中、已经上链，都按推送成功处理
+func (s *Sender) push(ctx context.Context, st *SendState) error {
+	if st.Signed == nil {
+		return xerrors.Errorf("send state has no signed message")
+	}
+	if st.Cid == "" {
+		st.Cid = st.Signed.Cid().String()
+	}
+
+	_, err := s.Client.MpoolPush(ctx, st.Signed)
+	if err == nil {
+		return nil
+	}
+
+	var rerr *RPCError
+	if xerrors.As(err, &rerr) && strings.Contains(rerr.Message, mpoolErrAlreadyIn) {
+		return nil
+	}
+	if pending, perr := s.Client.MpoolPending(ctx); perr == nil {
+		for _, m := range pending {
+			if m.Cid() == st.Signed.Cid() {
+				return nil
+			}
+		}
+	}
+	if lookup, lerr := s.Client.StateSearchMsg(ctx, st.Signed.Cid()); lerr == nil && lookup != nil {
+		return nil
+	}
+	return err
+}
+
+func (s *Sender) wait(ctx context.Context, st *SendState) error {
+	c, err := cid.Decode(st.Cid)
+	if err != nil {
+		return xerrors.Errorf("invalid message cid(%s): %v", st.Cid, err)
+	}
+
+	for {
+		lookup, err := s.Client.StateSearchMsg(ctx, c)
+		if err != nil {
+			return err
+		}
+		if lookup != nil {
+			st.Executed = lookup.Message.String()
+			st.Height = lookup.Height
+			st.Receipt = &lookup.Receipt
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.PollInterval):
+		}
+	}
+}
+
+// SendFIL 是 Sender 给 gomobile 的入口，value / maxFee 为 attoFIL，maxFee 可为空
+// 返回最终的 SendState json，出错时为 {"err": "...", "result": state}
+func (l *LotusClient) SendFIL(signer Signer, from, to, value, maxFee string, cb SendCallback) string {
+	f, err := address.NewFromString(from)
+	if err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid from address(%s): %v", from, err))
+	}
+	t, err := address.NewFromString(to)
+	if err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid to address(%s): %v", to, err))
+	}
+	v, err := BigFromString(value)
+	if err != nil || v.Sign() < 0 {
+		return rpcOut(nil, xerrors.Errorf("invalid value: %s", value))
+	}
+	mf, err := parseMaxFee(maxFee)
+	if err != nil {
+		return rpcOut(nil, err)
+	}
+
+	s := l.sender(signer, mf, cb)
+	return sendOut(s.Send(context.Background(), f, t, v))
+}
+
+// ResumeSend 从回调保存的 state json 继续发送
+func (l *LotusClient) ResumeSend(signer Signer, state, maxFee string, cb SendCallback) string {
+	var st SendState
+	if err := json.Unmarshal([]byte(state), &st); err != nil {
+		return rpcOut(nil, xerrors.Errorf("invalid send state: %v", err))
+	}
+	mf, err := parseMaxFee(maxFee)
+	if err != nil {
+		return rpcOut(nil, err)
+	}
+
+	s := l.sender(signer, mf, cb)
+	return sendOut(&st, s.Resume(context.Background(), &st))
+}
+
+// SetPollInterval 设置等待回执时的轮询间隔（毫秒），默认 10 秒
+func (l *LotusClient) SetPollInterval(ms int) {
+	l.poll = time.Duration(ms) * time.Millisecond
+}
+
+func (l *LotusClient) sender(signer Signer, maxFee abi.TokenAmount, cb SendCallback) *Sender {
+	s := NewSender(l.c, signer)
+	s.MaxFee = maxFee
+	s.Callback = cb
+	if l.poll > 0 {
+		s.PollInterval = l.poll
+	}
+	return s
+}
+
+func sendOut(st *SendState, err error) string {
+	o := &RPCOut{Result: st}
+	if err != nil {
+		o.Err = err.Error()
+	}
+
+	return jsonOut(o)
+}
@@ -0,0 +1,132 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+	"golang.org/x/xerrors"
+)
+
+type progress struct {
+	steps []string
+	last  string
+}
+
+func (p *progress) OnProgress(step, state string) {
+	p.steps = append(p.steps, step)
+	p.last = state
+}
+
+func TestSendFIL(t *testing.T) {
+	ck := "67WMRDA2ldmfcQ87DSHCy+ppKs3iSyNjxfBD7dR68Qw="
+	from := wlib.GenAddress(wlib.SecpPrivateToPublic(ck), "secp")
+
+	var pushed wlib.SignedMessage
+	var pushErr error
+	searches := 0
+	srv := mockLotus(t, "secret", map[string]rpcHandler{
+		"Filecoin.MpoolGetNonce": func([]json.RawMessage) (interface{}, error) {
+			return 5, nil
+		},
+		"Filecoin.GasEstimateMessageGas": func(params []json.RawMessage) (interface{}, error) {
+			var m wlib.Message
+			if err := json.Unmarshal(params[0], &m); err != nil {
+				return nil, err
+			}
+			assert.JSONEq(t, `{"MaxFee": "100000000000"}`, string(params[1]))
+			m.GasLimit = 1000000
+			m.GasFeeCap = wlib.NewInt(200000)
+			m.GasPremium = wlib.NewInt(100000)
+			return &m, nil
+		},
+		"Filecoin.MpoolPush": func(params []json.RawMessage) (interface{}, error) {
+			var sm wlib.SignedMessage
+			if err := json.Unmarshal(params[0], &sm); err != nil {
+				return nil, err
+			}
+			if pushErr != nil {
+				return nil, pushErr
+			}
+			if pushed.Cid() == sm.Cid() {
+				return nil, xerrors.Errorf("message from %s with nonce %d already in mpool: validation failure", sm.Message.From, sm.Message.Nonce)
+			}
+			pushed = sm
+			return pushed.Cid(), nil
+		},
+		"Filecoin.MpoolPending": func([]json.RawMessage) (interface{}, error) {
+			return []wlib.SignedMessage{pushed}, nil
+		},
+		"Filecoin.StateSearchMsg": func([]json.RawMessage) (interface{}, error) {
+			if searches++; searches < 2 {
+				return nil, nil
+			}
+			return map[string]interface{}{
+				"Message": pushed.Cid(),
+				"Receipt": map[string]interface{}{"ExitCode": 0, "Return": nil, "GasUsed": 500000},
+				"Height":  1234,
+			}, nil
+		},
+	})
+
+	signer, err := wlib.NewSecpSigner(ck)
+	require.NoError(t, err)
+
+	l := wlib.NewLotusClient(srv.URL, "secret")
+	l.SetPollInterval(10)
+
+	p := &progress{}
+	var st struct {
+		Err    string
+		Result wlib.SendState
+	}
+	require.NoError(t, json.Unmarshal([]byte(l.SendFIL(signer, from, "t01000", "1000", "100000000000", p)), &st))
+	require.Equal(t, "", st.Err)
+	require.Equal(t, []string{"nonce", "estimated", "signed", "pushed", "confirmed"}, p.steps)
+	require.Equal(t, uint64(5), st.Result.Message.Nonce)
+	require.Equal(t, "100000", st.Result.Message.GasFeeCap.String())
+	require.Equal(t, int64(500000), st.Result.Receipt.GasUsed)
+	require.Equal(t, pushed.Cid().String(), st.Result.Cid)
+	require.Len(t, pushed.Signature.Data, 65)
+
+	// the app was killed after the push: resuming only waits for the receipt
+	var resumed wlib.SendState
+	require.NoError(t, json.Unmarshal([]byte(p.last), &resumed))
+	resumed.Step = wlib.SendStepPushed
+	resumed.Receipt = nil
+	state, err := json.Marshal(&resumed)
+	require.NoError(t, err)
+
+	p = &progress{}
+	require.NoError(t, json.Unmarshal([]byte(l.ResumeSend(signer, string(state), "", p)), &st))
+	require.Equal(t, "", st.Err)
+	require.Equal(t, []string{"confirmed"}, p.steps)
+	require.NotNil(t, st.Result.Receipt)
+
+	// killed after MpoolPush succeeded but before the pushed step was saved:
+	// the node rejects the second push as already in mpool
+	resumed.Step = wlib.SendStepSigned
+	state, err = json.Marshal(&resumed)
+	require.NoError(t, err)
+
+	p = &progress{}
+	require.NoError(t, json.Unmarshal([]byte(l.ResumeSend(signer, string(state), "", p)), &st))
+	require.Equal(t, "", st.Err)
+	require.Equal(t, []string{"pushed", "confirmed"}, p.steps)
+	require.Equal(t, pushed.Cid().String(), st.Result.Cid)
+
+	// the node answers the second push with some other error, but the
+	// message is still pending in the mpool
+	pushErr = xerrors.Errorf("connection reset")
+	before := searches
+	p = &progress{}
+	require.NoError(t, json.Unmarshal([]byte(l.ResumeSend(signer, string(state), "", p)), &st))
+	require.Equal(t, "", st.Err)
+	require.Equal(t, []string{"pushed", "confirmed"}, p.steps)
+	require.Equal(t, before+1, searches, "only the receipt wait searches the chain")
+	pushErr = nil
+
+	require.Contains(t, wlib.NewLotusClient(srv.URL, "").SendFIL(signer, from, "t01000", "1000", "", nil), "401")
+}
@@ -0,0 +1,197 @@
+// Package signer 是兼容 lotus 钱包 API 的远程签名服务，lotus 节点可以把它
+// 配置为远程钱包（与 lotus-wallet 相同）
+package signer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/xerrors"
+)
+
+// KeyType 与 lotus types.KeyType 相同，签名服务只支持 secp256k1，
+// KTBLS 只用于识别并拒绝 bls 私钥
+type KeyType string
+
+const (
+	KTSecp256k1 KeyType = "secp256k1"
+	KTBLS       KeyType = "bls"
+)
+
+// KeyInfo 与 lotus types.KeyInfo 相同，用于 WalletExport / WalletImport
+type KeyInfo struct {
+	Type       KeyType
+	PrivateKey []byte
+}
+
+// ErrKeyNotFound 地址不在 keystore 中
+var ErrKeyNotFound = xerrors.New("key not found")
+
+const (
+	saltFile  = "keystore.salt"
+	checkFile = "keystore.check"
+	checkText = "wlib keystore"
+	keySuffix = ".key"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Keystore 把私钥用 AES-256-GCM 加密后保存在目录下，每个地址一个文件。
+// 加密密钥由口令经 scrypt 派生，打开时派生一次
+type Keystore struct {
+	mu   sync.Mutex
+	dir  string
+	aead cipher.AEAD
+}
+
+type sealed struct {
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// OpenKeystore 打开或创建 dir 下的 keystore，口令错误时返回错误
+func OpenKeystore(dir, passphrase string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("failed to create keystore %s: %v", dir, err)
+	}
+
+	salt, err := ioutil.ReadFile(filepath.Join(dir, saltFile))
+	if os.IsNotExist(err) {
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, saltFile), salt, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{dir: dir, aead: aead}
+	check, err := ks.read(checkFile)
+	if os.IsNotExist(err) {
+		return ks, ks.write(checkFile, []byte(checkText))
+	}
+	if err != nil || string(check) != checkText {
+		return nil, xerrors.Errorf("wrong keystore passphrase")
+	}
+	return ks, nil
+}
+
+func (ks *Keystore) read(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(ks.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	var s sealed
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, xerrors.Errorf("corrupt keystore entry %s: %v", name, err)
+	}
+	return ks.aead.Open(nil, s.Nonce, s.Ciphertext, []byte(name))
+}
+
+func (ks *Keystore) write(name string, data []byte) error {
+	s := sealed{Nonce: make([]byte, ks.aead.NonceSize())}
+	if _, err := rand.Read(s.Nonce); err != nil {
+		return err
+	}
+	s.Ciphertext = ks.aead.Seal(nil, s.Nonce, data, []byte(name))
+
+	b, err := json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(ks.dir, name)
+	if err := ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// List 返回所有地址，按字符串排序
+func (ks *Keystore) List() ([]string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	entries, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), keySuffix) {
+			out = append(out, strings.TrimSuffix(e.Name(), keySuffix))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (ks *Keystore) Get(addr string) (*KeyInfo, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	b, err := ks.read(addr + keySuffix)
+	if os.IsNotExist(err) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ki KeyInfo
+	if err := json.Unmarshal(b, &ki); err != nil {
+		return nil, err
+	}
+	return &ki, nil
+}
+
+func (ks *Keystore) Put(addr string, ki *KeyInfo) error {
+	b, err := json.Marshal(ki)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.write(addr+keySuffix, b)
+}
+
+func (ks *Keystore) Delete(addr string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	err := os.Remove(filepath.Join(ks.dir, addr+keySuffix))
+	if os.IsNotExist(err) {
+		return ErrKeyNotFound
+	}
+	return err
+}
@@ -0,0 +1,444 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+// Policy 是签名前检查的规则，从 json 或 yaml 文件加载，例如
+//
+//	default:
+//	  daily_limit: 100 FIL
+//	  max_gas_fee_cap: "10000000000"
+//	  deny_methods: [23]          # miner ChangeOwnerAddress
+//	addresses:
+//	  f1abc...:
+//	    allow_to: [f01234, f1xyz...]
+//	    require_confirmation:
+//	      above: 10 FIL
+//	ids:
+//	  f01234: f1abc...
+//
+// 规则按签名的地址选择，地址没有单独的规则时使用 default，都没有时不限制
+type Policy struct {
+	Default   *Rule            `json:"default" yaml:"default"`
+	Addresses map[string]*Rule `json:"addresses" yaml:"addresses"`
+	// IDs 是 ID 地址到密钥地址的映射。消息的 From 必须是签名的地址，
+	// 或者在这里映射到签名地址的 ID 地址，否则拒绝签名
+	IDs map[string]string `json:"ids" yaml:"ids"`
+}
+
+type Rule struct {
+	// DailyLimit 每个 UTC 日内 Value 之和的上限，如 "100 FIL"。
+	// 在签名时计入，签名后没有上链的消息也会计入；
+	// 没有调用 PersistSpend 时只保存在内存中，重启后清零
+	DailyLimit   string   `json:"daily_limit" yaml:"daily_limit"`
+	AllowTo      []string `json:"allow_to" yaml:"allow_to"`
+	DenyTo       []string `json:"deny_to" yaml:"deny_to"`
+	AllowMethods []uint64 `json:"allow_methods" yaml:"allow_methods"`
+	DenyMethods  []uint64 `json:"deny_methods" yaml:"deny_methods"`
+	// MaxGasFeeCap 单位 attoFIL
+	MaxGasFeeCap string `json:"max_gas_fee_cap" yaml:"max_gas_fee_cap"`
+	// AllowRawSign 是否允许签名非消息的数据（区块、交易提案等）
+	AllowRawSign        bool         `json:"allow_raw_sign" yaml:"allow_raw_sign"`
+	RequireConfirmation *ConfirmRule `json:"require_confirmation" yaml:"require_confirmation"`
+}
+
+// ConfirmRule 满足任一条件的消息需要人工确认
+type ConfirmRule struct {
+	Above   string   `json:"above" yaml:"above"`
+	Methods []uint64 `json:"methods" yaml:"methods"`
+	To      []string `json:"to" yaml:"to"`
+}
+
+// LoadPolicy 按扩展名解析 .yaml / .yml，其余按 json。未知的字段报错，
+// 避免拼错的规则被忽略
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err = dec.Decode(&p); err == io.EOF {
+			err = nil
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&p)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("invalid policy %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+// Denial 是拒绝签名的原因，作为 JSON-RPC 错误的 data 返回
+type Denial struct {
+	Address string `json:"address"`
+	Rule    string `json:"rule"`
+	Reason  string `json:"reason"`
+}
+
+func (d *Denial) Error() string {
+	return fmt.Sprintf("denied by policy %s: %s", d.Rule, d.Reason)
+}
+
+// Confirmer 向人请求确认，返回 false 表示拒绝
+type Confirmer interface {
+	Confirm(ctx context.Context, msg *wlib.Message, reason string) (bool, error)
+}
+
+type addrSet map[string]bool
+
+func (s addrSet) has(a address.Address) bool {
+	return s[string(a.Bytes())]
+}
+
+type compiledRule struct {
+	dailyLimit   *abi.TokenAmount
+	allowTo      addrSet
+	denyTo       addrSet
+	allowMethods map[abi.MethodNum]bool
+	denyMethods  map[abi.MethodNum]bool
+	maxGasFeeCap *abi.TokenAmount
+	allowRaw     bool
+
+	confirm        bool
+	confirmAbove   *abi.TokenAmount
+	confirmMethods map[abi.MethodNum]bool
+	confirmTo      addrSet
+}
+
+func parseAddrSet(addrs []string) (addrSet, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	s := addrSet{}
+	for _, str := range addrs {
+		a, err := address.NewFromString(str)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid address(%s): %v", str, err)
+		}
+		s[string(a.Bytes())] = true
+	}
+	return s, nil
+}
+
+func methodSet(ms []uint64) map[abi.MethodNum]bool {
+	if len(ms) == 0 {
+		return nil
+	}
+	s := map[abi.MethodNum]bool{}
+	for _, m := range ms {
+		s[abi.MethodNum(m)] = true
+	}
+	return s
+}
+
+func parseFIL(s string) (*abi.TokenAmount, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, err := wlib.ParseFIL(s)
+	if err != nil {
+		return nil, err
+	}
+	v := abi.TokenAmount(f)
+	return &v, nil
+}
+
+func compileRule(r *Rule) (*compiledRule, error) {
+	c := &compiledRule{
+		allowMethods: methodSet(r.AllowMethods),
+		denyMethods:  methodSet(r.DenyMethods),
+		allowRaw:     r.AllowRawSign,
+	}
+
+	var err error
+	if c.dailyLimit, err = parseFIL(r.DailyLimit); err != nil {
+		return nil, xerrors.Errorf("invalid daily_limit: %v", err)
+	}
+	if c.allowTo, err = parseAddrSet(r.AllowTo); err != nil {
+		return nil, xerrors.Errorf("invalid allow_to: %v", err)
+	}
+	if c.denyTo, err = parseAddrSet(r.DenyTo); err != nil {
+		return nil, xerrors.Errorf("invalid deny_to: %v", err)
+	}
+	if r.MaxGasFeeCap != "" {
+		v, err := wlib.BigFromString(r.MaxGasFeeCap)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid max_gas_fee_cap: %v", err)
+		}
+		c.maxGasFeeCap = &v
+	}
+
+	if rc := r.RequireConfirmation; rc != nil {
+		c.confirm = true
+		if c.confirmAbove, err = parseFIL(rc.Above); err != nil {
+			return nil, xerrors.Errorf("invalid require_confirmation.above: %v", err)
+		}
+		if c.confirmTo, err = parseAddrSet(rc.To); err != nil {
+			return nil, xerrors.Errorf("invalid require_confirmation.to: %v", err)
+		}
+		c.confirmMethods = methodSet(rc.Methods)
+	}
+	return c, nil
+}
+
+// PolicyEngine 在签名前执行 Policy，并记录每个签名地址当天的花费
+type PolicyEngine struct {
+	def       *compiledRule
+	addresses map[string]*compiledRule
+	ids       map[string]address.Address
+
+	// Confirmer 为 nil 时需要确认的消息都被拒绝
+	Confirmer Confirmer
+
+	mu        sync.Mutex
+	spent     map[string]*daySpend
+	spendFile string
+	now       func() time.Time
+}
+
+type daySpend struct {
+	Day    string          `json:"day"`
+	Amount abi.TokenAmount `json:"amount"`
+}
+
+func NewPolicyEngine(p *Policy) (*PolicyEngine, error) {
+	e := &PolicyEngine{
+		addresses: map[string]*compiledRule{},
+		ids:       map[string]address.Address{},
+		spent:     map[string]*daySpend{},
+		now:       time.Now,
+	}
+
+	var err error
+	if p.Default != nil {
+		if e.def, err = compileRule(p.Default); err != nil {
+			return nil, xerrors.Errorf("default: %v", err)
+		}
+	}
+	for str, r := range p.Addresses {
+		a, err := address.NewFromString(str)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid address(%s): %v", str, err)
+		}
+		if e.addresses[string(a.Bytes())], err = compileRule(r); err != nil {
+			return nil, xerrors.Errorf("%s: %v", str, err)
+		}
+	}
+	for idStr, keyStr := range p.IDs {
+		id, err := address.NewFromString(idStr)
+		if err != nil || id.Protocol() != address.ID {
+			return nil, xerrors.Errorf("invalid id address(%s)", idStr)
+		}
+		key, err := address.NewFromString(keyStr)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid address(%s): %v", keyStr, err)
+		}
+		e.ids[string(id.Bytes())] = key
+	}
+	return e, nil
+}
+
+// LoadPolicyEngine 从文件加载规则
+func LoadPolicyEngine(path string) (*PolicyEngine, error) {
+	p, err := LoadPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicyEngine(p)
+}
+
+// PersistSpend 把每天的花费保存在 path，文件已存在时先读取，
+// 这样重启后 daily_limit 仍然有效
+func (e *PolicyEngine) PersistSpend(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		var saved map[string]*daySpend
+		if err := json.Unmarshal(b, &saved); err != nil {
+			return xerrors.Errorf("invalid spend file %s: %v", path, err)
+		}
+		for str, spent := range saved {
+			a, err := address.NewFromString(str)
+			if err != nil {
+				return xerrors.Errorf("invalid address(%s) in %s: %v", str, path, err)
+			}
+			e.spent[string(a.Bytes())] = spent
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	e.spendFile = path
+	return nil
+}
+
+func (e *PolicyEngine) saveSpent() error {
+	if e.spendFile == "" {
+		return nil
+	}
+	out := map[string]*daySpend{}
+	for k, spent := range e.spent {
+		a, err := address.NewFromBytes([]byte(k))
+		if err != nil {
+			return err
+		}
+		out[a.String()] = spent
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(e.spendFile+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(e.spendFile+".tmp", e.spendFile)
+}
+
+func (e *PolicyEngine) rule(a address.Address) *compiledRule {
+	if r, ok := e.addresses[string(a.Bytes())]; ok {
+		return r
+	}
+	return e.def
+}
+
+// AuthorizeRaw 检查非消息数据的签名。data 是消息 cid（dag-cbor、blake2b-256）时
+// 总是拒绝，否则签名的消息会绕过 Authorize 的检查；区块的签名数据也是这种 cid，
+// 所以启用 Policy 时不能签名区块
+func (e *PolicyEngine) AuthorizeRaw(signer address.Address, data []byte, meta MsgMeta) error {
+	if isMessageCid(data) {
+		return &Denial{Address: signer.String(), Rule: "allow_raw_sign",
+			Reason: fmt.Sprintf("%q data is a message cid, sign the message with its meta instead", meta.Type)}
+	}
+
+	r := e.rule(signer)
+	if r == nil || r.allowRaw {
+		return nil
+	}
+	return &Denial{Address: signer.String(), Rule: "allow_raw_sign",
+		Reason: fmt.Sprintf("signing %q data is not allowed", meta.Type)}
+}
+
+func isMessageCid(data []byte) bool {
+	c, err := cid.Cast(data)
+	if err != nil || c.Version() != 1 || c.Type() != cid.DagCBOR {
+		return false
+	}
+	return c.Prefix().MhType == multihash.BLAKE2B_MIN+31
+}
+
+// Authorize 检查 signer 要签名的消息，通过时计入 signer 当天的花费
+func (e *PolicyEngine) Authorize(ctx context.Context, signer address.Address, msg *wlib.Message) error {
+	deny := func(rule, format string, args ...interface{}) error {
+		return &Denial{Address: signer.String(), Rule: rule, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	// 规则和花费都按签名地址记录，From 换成其它形式的地址不能绕过
+	if msg.From != signer && e.ids[string(msg.From.Bytes())] != signer {
+		return deny("ids", "message from %s cannot be signed by %s, map the id address to it in ids", msg.From.String(), signer.String())
+	}
+
+	r := e.rule(signer)
+	if r == nil {
+		return nil
+	}
+
+	if r.denyTo.has(msg.To) {
+		return deny("deny_to", "recipient %s is denied", msg.To.String())
+	}
+	if r.allowTo != nil && !r.allowTo.has(msg.To) {
+		return deny("allow_to", "recipient %s is not in the allowlist", msg.To.String())
+	}
+	if r.denyMethods[msg.Method] {
+		return deny("deny_methods", "method %d is denied", msg.Method)
+	}
+	if r.allowMethods != nil && !r.allowMethods[msg.Method] {
+		return deny("allow_methods", "method %d is not allowed", msg.Method)
+	}
+	if r.maxGasFeeCap != nil && msg.GasFeeCap.GreaterThan(*r.maxGasFeeCap) {
+		return deny("max_gas_fee_cap", "gas fee cap %s exceeds %s", msg.GasFeeCap, *r.maxGasFeeCap)
+	}
+
+	if reason := r.confirmReason(msg); reason != "" {
+		if e.Confirmer == nil {
+			return deny("require_confirmation", "%s, but no confirmer is configured", reason)
+		}
+		ok, err := e.Confirmer.Confirm(ctx, msg, reason)
+		if err != nil {
+			return deny("require_confirmation", "confirmation failed: %v", err)
+		}
+		if !ok {
+			return deny("require_confirmation", "%s, rejected by the operator", reason)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := string(signer.Bytes())
+	day := e.now().UTC().Format("2006-01-02")
+	prev := e.spent[key]
+	amount := wlib.NewInt(0)
+	if prev != nil && prev.Day == day {
+		amount = prev.Amount
+	}
+	total := wlib.BigAdd(amount, msg.Value)
+	if r.dailyLimit != nil && total.GreaterThan(*r.dailyLimit) {
+		return deny("daily_limit", "spending %s today would exceed the daily limit of %s",
+			wlib.FIL(total).Short(), wlib.FIL(*r.dailyLimit).Short())
+	}
+	e.spent[key] = &daySpend{Day: day, Amount: total}
+	if err := e.saveSpent(); err != nil {
+		e.spent[key] = prev
+		if prev == nil {
+			delete(e.spent, key)
+		}
+		return xerrors.Errorf("failed to save spend: %v", err)
+	}
+	return nil
+}
+
+func (r *compiledRule) confirmReason(msg *wlib.Message) string {
+	if !r.confirm {
+		return ""
+	}
+	switch {
+	case r.confirmAbove != nil && msg.Value.GreaterThan(*r.confirmAbove):
+		return fmt.Sprintf("value %s above %s requires confirmation", wlib.FIL(msg.Value).Short(), wlib.FIL(*r.confirmAbove).Short())
+	case r.confirmMethods[msg.Method]:
+		return fmt.Sprintf("method %d requires confirmation", msg.Method)
+	case r.confirmTo.has(msg.To):
+		return fmt.Sprintf("sending to %s requires confirmation", msg.To.String())
+	case r.confirmAbove == nil && r.confirmMethods == nil && r.confirmTo == nil:
+		return "every message requires confirmation"
+	}
+	return ""
+}
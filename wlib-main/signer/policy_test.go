@@ -0,0 +1,159 @@
+package signer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib/signer"
+)
+
+const testPolicy = `
+default:
+  daily_limit: 2 FIL
+  deny_to: [f01002]
+  deny_methods: [23]
+  require_confirmation:
+    above: 1.5 FIL
+ids:
+  f01001: f153zbrv25wvfrqf2vrvlk2qmpietuu6wexiyerja
+`
+
+// testKey is the key address that f01001 maps to in testPolicy
+const testKey = "f153zbrv25wvfrqf2vrvlk2qmpietuu6wexiyerja"
+
+type confirmer bool
+
+func (c confirmer) Confirm(context.Context, *wlib.Message, string) (bool, error) {
+	return bool(c), nil
+}
+
+func policyMsg(to uint64, method uint64, value string) *wlib.Message {
+	from, _ := address.NewIDAddress(1001)
+	toAddr, _ := address.NewIDAddress(to)
+	v, _ := wlib.ParseFIL(value)
+	return &wlib.Message{To: toAddr, From: from, Method: abi.MethodNum(method), Value: wlib.BigInt(v),
+		GasLimit: 1000000, GasFeeCap: wlib.NewInt(100), GasPremium: wlib.NewInt(100)}
+}
+
+func denialRule(t *testing.T, err error) string {
+	var d *signer.Denial
+	require.True(t, xerrors.As(err, &d), "%v", err)
+	return d.Rule
+}
+
+func loadTestPolicy(t *testing.T, dir string) *signer.PolicyEngine {
+	path := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(testPolicy), 0600))
+	e, err := signer.LoadPolicyEngine(path)
+	require.NoError(t, err)
+	return e
+}
+
+func TestPolicyEngine(t *testing.T) {
+	e := loadTestPolicy(t, t.TempDir())
+	key, err := address.NewFromString(testKey)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.Equal(t, "deny_to", denialRule(t, e.Authorize(ctx, key, policyMsg(1002, 0, "1"))))
+	require.Equal(t, "deny_methods", denialRule(t, e.Authorize(ctx, key, policyMsg(1000, 23, "0"))))
+	require.Equal(t, "require_confirmation", denialRule(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1.6"))))
+
+	require.NoError(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1.2")))
+	require.Equal(t, "daily_limit", denialRule(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1"))))
+
+	e.Confirmer = confirmer(false)
+	require.Equal(t, "require_confirmation", denialRule(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1.6"))))
+
+	require.Equal(t, "allow_raw_sign", denialRule(t, e.AuthorizeRaw(key, []byte("block"), signer.MsgMeta{Type: "block"})))
+}
+
+func TestLoadPolicyUnknownField(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"policy.yaml": "default:\n  daily_limt: 2 FIL\n",
+		"policy.json": `{"default": {"deny_too": ["f01002"]}}`,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		_, err := signer.LoadPolicy(path)
+		require.Error(t, err, name)
+		require.Contains(t, err.Error(), "invalid policy", name)
+	}
+}
+
+func TestPolicyEngineSenderForms(t *testing.T) {
+	dir := t.TempDir()
+	e := loadTestPolicy(t, dir)
+	require.NoError(t, e.PersistSpend(filepath.Join(dir, "policy.spent")))
+	key, err := address.NewFromString(testKey)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// the mapped id address and the key address share one daily ledger
+	require.NoError(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1.2")))
+	msg := policyMsg(1000, 0, "1")
+	msg.From = key
+	require.Equal(t, "daily_limit", denialRule(t, e.Authorize(ctx, key, msg)))
+
+	// an id address that is not mapped to the key is rejected
+	other, _ := address.NewIDAddress(1003)
+	msg.From = other
+	require.Equal(t, "ids", denialRule(t, e.Authorize(ctx, key, msg)))
+	msg.Value = wlib.NewInt(0)
+	require.Equal(t, "ids", denialRule(t, e.Authorize(ctx, key, msg)))
+
+	// the spend survives a restart
+	e = loadTestPolicy(t, dir)
+	require.NoError(t, e.PersistSpend(filepath.Join(dir, "policy.spent")))
+	require.Equal(t, "daily_limit", denialRule(t, e.Authorize(ctx, key, policyMsg(1000, 0, "1"))))
+	require.NoError(t, e.Authorize(ctx, key, policyMsg(1000, 0, "0.5")))
+}
+
+func TestServerPolicyDenial(t *testing.T) {
+	ks, err := signer.OpenKeystore(t.TempDir(), "secret")
+	require.NoError(t, err)
+	s := signer.NewServer(ks, map[string]signer.Perm{"signer": signer.PermSign}, nil)
+	s.Policy, err = signer.NewPolicyEngine(&signer.Policy{Default: &signer.Rule{DenyMethods: []uint64{23}}})
+	require.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := wlib.NewClient(srv.URL, "signer")
+	var addr string
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletNew", &addr, "secp256k1"))
+
+	msg := policyMsg(1000, 23, "0")
+	msg.From, err = address.NewFromString(addr)
+	require.NoError(t, err)
+
+	var sm wlib.SignedMessage
+	err = c.Call(ctx, "Filecoin.WalletSignMessage", &sm, addr, msg)
+	var rpcErr *wlib.RPCError
+	require.True(t, xerrors.As(err, &rpcErr), "%v", err)
+	require.Equal(t, 403, rpcErr.Code)
+	require.Equal(t, "deny_methods", rpcErr.Data.(map[string]interface{})["rule"])
+
+	// the message cid signed as raw data skips the message rules, so it is denied even with allow_raw_sign
+	s.Policy, err = signer.NewPolicyEngine(&signer.Policy{Default: &signer.Rule{DenyMethods: []uint64{23}, AllowRawSign: true}})
+	require.NoError(t, err)
+	var sig struct {
+		Type int
+		Data []byte
+	}
+	err = c.Call(ctx, "Filecoin.WalletSign", &sig, addr, msg.Cid().Bytes(), signer.MsgMeta{Type: "deal"})
+	require.True(t, xerrors.As(err, &rpcErr), "%v", err)
+	require.Equal(t, 403, rpcErr.Code)
+	require.Contains(t, rpcErr.Message, "message cid")
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletSign", &sig, addr, []byte("deal proposal"), signer.MsgMeta{Type: "deal"}))
+}
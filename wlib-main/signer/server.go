@@ -0,0 +1,384 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	gocrypto "github.com/filecoin-project/go-crypto"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/minio/blake2b-simd"
+	"golang.org/x/xerrors"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+// Perm 与 lotus api 的权限相同，高权限包含低权限
+type Perm string
+
+const (
+	PermRead  Perm = "read"
+	PermWrite Perm = "write"
+	PermSign  Perm = "sign"
+	PermAdmin Perm = "admin"
+)
+
+var permLevel = map[Perm]int{PermRead: 1, PermWrite: 2, PermSign: 3, PermAdmin: 4}
+
+// MsgMeta 与 lotus api.MsgMeta 相同，Type 为 "message" 时 Extra 是 cbor 编码的消息
+type MsgMeta struct {
+	Type  string
+	Extra []byte
+}
+
+const MTChainMsg = "message"
+
+type method struct {
+	perm Perm
+	call func(s *Server, ctx context.Context, params []json.RawMessage) (interface{}, error)
+}
+
+var methods = map[string]method{
+	"Filecoin.WalletNew":         {PermWrite, (*Server).walletNew},
+	"Filecoin.WalletHas":         {PermWrite, (*Server).walletHas},
+	"Filecoin.WalletList":        {PermWrite, (*Server).walletList},
+	"Filecoin.WalletSign":        {PermSign, (*Server).walletSign},
+	"Filecoin.WalletSignMessage": {PermSign, (*Server).walletSignMessage},
+	"Filecoin.WalletExport":      {PermAdmin, (*Server).walletExport},
+	"Filecoin.WalletImport":      {PermAdmin, (*Server).walletImport},
+	"Filecoin.WalletDelete":      {PermAdmin, (*Server).walletDelete},
+}
+
+// Server 是 JSON-RPC 2.0 的 http handler
+type Server struct {
+	ks *Keystore
+	// Tokens 是 bearer token 到权限的映射
+	Tokens map[string]Perm
+	// AccessLog 为 nil 时不记录
+	AccessLog *log.Logger
+	// Policy 为 nil 时不检查
+	Policy *PolicyEngine
+}
+
+func NewServer(ks *Keystore, tokens map[string]Perm, accessLog io.Writer) *Server {
+	s := &Server{ks: ks, Tokens: tokens}
+	if accessLog != nil {
+		s.AccessLog = log.New(accessLog, "", log.LstdFlags|log.LUTC)
+	}
+	return s
+}
+
+type request struct {
+	Jsonrpc string            `json:"jsonrpc"`
+	ID      interface{}       `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	ID      interface{}    `json:"id"`
+	Result  interface{}    `json:"result,omitempty"`
+	Error   *wlib.RPCError `json:"error,omitempty"`
+}
+
+// JSON-RPC 错误码
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeUnauthorized   = 401
+	codeDenied         = 403
+	codeInternal       = 1
+)
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	perm, authorized := s.Tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+
+	var req request
+	resp := &response{Jsonrpc: "2.0"}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		resp.Error = &wlib.RPCError{Code: codeParseError, Message: err.Error()}
+	} else {
+		resp.ID = req.ID
+		resp.Result, resp.Error = s.handle(r.Context(), &req, perm, authorized)
+	}
+
+	status := "ok"
+	if resp.Error != nil {
+		status = resp.Error.Message
+	}
+	if s.AccessLog != nil {
+		s.AccessLog.Printf("%s %s perm=%s %s %s", r.RemoteAddr, req.Method, perm, time.Since(start).Round(time.Microsecond), status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handle(ctx context.Context, req *request, perm Perm, authorized bool) (interface{}, *wlib.RPCError) {
+	m, ok := methods[req.Method]
+	if !ok {
+		return nil, &wlib.RPCError{Code: codeMethodNotFound, Message: fmt.Sprintf("method '%s' not found", req.Method)}
+	}
+	if !authorized || permLevel[perm] < permLevel[m.perm] {
+		return nil, &wlib.RPCError{Code: codeUnauthorized, Message: fmt.Sprintf("missing permission to invoke '%s' (need '%s')", req.Method, m.perm)}
+	}
+
+	res, err := m.call(s, ctx, req.Params)
+	if err != nil {
+		var pe paramError
+		var denial *Denial
+		switch {
+		case xerrors.As(err, &denial):
+			return nil, &wlib.RPCError{Code: codeDenied, Message: err.Error(), Data: denial}
+		case xerrors.As(err, &pe):
+			return nil, &wlib.RPCError{Code: codeInvalidParams, Message: err.Error()}
+		default:
+			return nil, &wlib.RPCError{Code: codeInternal, Message: err.Error()}
+		}
+	}
+	return res, nil
+}
+
+type paramError struct {
+	error
+}
+
+func param(params []json.RawMessage, i int, v interface{}) error {
+	if i >= len(params) {
+		return paramError{xerrors.Errorf("missing param %d", i)}
+	}
+	if err := json.Unmarshal(params[i], v); err != nil {
+		return paramError{xerrors.Errorf("invalid param %d: %v", i, err)}
+	}
+	return nil
+}
+
+func addressParam(params []json.RawMessage, i int) (address.Address, error) {
+	var s string
+	if err := param(params, i, &s); err != nil {
+		return address.Undef, err
+	}
+	a, err := address.NewFromString(s)
+	if err != nil {
+		return address.Undef, paramError{xerrors.Errorf("invalid address(%s): %v", s, err)}
+	}
+	return a, nil
+}
+
+// keyName 文件名统一使用 f 前缀，与当前网络无关
+func keyName(a address.Address) string {
+	return address.MainnetPrefix + a.String()[1:]
+}
+
+func (s *Server) key(a address.Address) (*KeyInfo, error) {
+	ki, err := s.ks.Get(keyName(a))
+	if err != nil {
+		return nil, xerrors.Errorf("%s: %w", a.String(), err)
+	}
+	return ki, nil
+}
+
+// secp256k1N 是 secp256k1 的阶
+var secp256k1N, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+
+// addressOf 只支持 secp256k1，私钥必须是 32 字节且在 [1, n) 内
+func addressOf(ki *KeyInfo) (address.Address, error) {
+	if ki.Type != KTSecp256k1 {
+		return address.Undef, xerrors.Errorf("unsupported key type %q, only %q is supported", ki.Type, KTSecp256k1)
+	}
+	if len(ki.PrivateKey) != 32 {
+		return address.Undef, xerrors.Errorf("invalid secp256k1 private key length %d, expect 32", len(ki.PrivateKey))
+	}
+	d := new(big.Int).SetBytes(ki.PrivateKey)
+	if d.Sign() == 0 || d.Cmp(secp256k1N) >= 0 {
+		return address.Undef, xerrors.Errorf("invalid secp256k1 private key, out of range")
+	}
+	return address.NewSecp256k1Address(gocrypto.PublicKey(ki.PrivateKey))
+}
+
+func sign(ki *KeyInfo, data []byte) (*crypto.Signature, error) {
+	if ki.Type != KTSecp256k1 {
+		return nil, xerrors.Errorf("unsupported key type %q", ki.Type)
+	}
+	b2sum := blake2b.Sum256(data)
+	sig, err := gocrypto.Sign(ki.PrivateKey, b2sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return &crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: sig}, nil
+}
+
+func (s *Server) put(ki *KeyInfo) (string, error) {
+	a, err := addressOf(ki)
+	if err != nil {
+		return "", err
+	}
+	if err := s.ks.Put(keyName(a), ki); err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+func (s *Server) walletNew(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var kt KeyType
+	if err := param(params, 0, &kt); err != nil {
+		return nil, err
+	}
+	if kt != KTSecp256k1 {
+		return nil, xerrors.Errorf("unsupported key type %q, only %q is supported", kt, KTSecp256k1)
+	}
+
+	pk, err := gocrypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	return s.put(&KeyInfo{Type: kt, PrivateKey: pk})
+}
+
+func (s *Server) walletHas(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	a, err := addressParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.ks.Get(keyName(a))
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Server) walletList(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	names, err := s.ks.List()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	for _, n := range names {
+		a, err := address.NewFromString(n)
+		if err != nil {
+			continue
+		}
+		out = append(out, a.String())
+	}
+	return out, nil
+}
+
+func (s *Server) walletSign(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	a, err := addressParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if err := param(params, 1, &data); err != nil {
+		return nil, err
+	}
+	var meta MsgMeta
+	if len(params) > 2 {
+		if err := param(params, 2, &meta); err != nil {
+			return nil, err
+		}
+	}
+
+	ki, err := s.key(a)
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名消息时 data 必须是 Extra 中消息的 cid
+	if meta.Type == MTChainMsg {
+		var msg wlib.Message
+		if err := msg.UnmarshalCBOR(bytes.NewReader(meta.Extra)); err != nil {
+			return nil, paramError{xerrors.Errorf("invalid message in meta: %v", err)}
+		}
+		if !bytes.Equal(msg.Cid().Bytes(), data) {
+			return nil, paramError{xerrors.Errorf("signing bytes do not match the message cid")}
+		}
+		if err := s.authorize(ctx, a, &msg); err != nil {
+			return nil, err
+		}
+	} else if s.Policy != nil {
+		if err := s.Policy.AuthorizeRaw(a, data, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	return sign(ki, data)
+}
+
+func (s *Server) authorize(ctx context.Context, signer address.Address, msg *wlib.Message) error {
+	if s.Policy == nil {
+		return nil
+	}
+	return s.Policy.Authorize(ctx, signer, msg)
+}
+
+func (s *Server) walletSignMessage(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	a, err := addressParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	var msg wlib.Message
+	if err := param(params, 1, &msg); err != nil {
+		return nil, err
+	}
+
+	ki, err := s.key(a)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, a, &msg); err != nil {
+		return nil, err
+	}
+	sig, err := sign(ki, msg.Cid().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &wlib.SignedMessage{Message: msg, Signature: *sig}, nil
+}
+
+func (s *Server) walletExport(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	a, err := addressParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.key(a)
+}
+
+func (s *Server) walletImport(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var ki KeyInfo
+	if err := param(params, 0, &ki); err != nil {
+		return nil, err
+	}
+	if _, err := addressOf(&ki); err != nil {
+		return nil, paramError{err}
+	}
+	return s.put(&ki)
+}
+
+func (s *Server) walletDelete(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	a, err := addressParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ks.Delete(keyName(a)); err != nil {
+		return nil, xerrors.Errorf("%s: %w", a.String(), err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+package signer_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib/signer"
+)
+
+func TestKeystorePassphrase(t *testing.T) {
+	dir := t.TempDir()
+	_, err := signer.OpenKeystore(dir, "secret")
+	require.NoError(t, err)
+
+	_, err = signer.OpenKeystore(dir, "wrong")
+	require.Contains(t, err.Error(), "passphrase")
+}
+
+func TestServer(t *testing.T) {
+	ks, err := signer.OpenKeystore(t.TempDir(), "secret")
+	require.NoError(t, err)
+
+	var accessLog bytes.Buffer
+	srv := httptest.NewServer(signer.NewServer(ks, map[string]signer.Perm{
+		"signer": signer.PermSign,
+		"admin":  signer.PermAdmin,
+	}, &accessLog))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := wlib.NewClient(srv.URL, "signer")
+	admin := wlib.NewClient(srv.URL, "admin")
+
+	var addr string
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletNew", &addr, "secp256k1"))
+	var list []string
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletList", &list))
+	require.Equal(t, []string{addr}, list)
+
+	// message signing is bound to the message in the meta
+	to, _ := address.NewIDAddress(1000)
+	from, err := address.NewFromString(addr)
+	require.NoError(t, err)
+	msg := &wlib.Message{To: to, From: from, Value: wlib.NewInt(1), GasLimit: 1000000,
+		GasFeeCap: wlib.NewInt(100), GasPremium: wlib.NewInt(100)}
+	var buf bytes.Buffer
+	require.NoError(t, msg.MarshalCBOR(&buf))
+
+	var sig struct {
+		Type int
+		Data []byte
+	}
+	meta := signer.MsgMeta{Type: signer.MTChainMsg, Extra: buf.Bytes()}
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletSign", &sig, addr, msg.Cid().Bytes(), meta))
+	require.Equal(t, 1, sig.Type)
+	require.Len(t, sig.Data, 65)
+	require.Contains(t, c.Call(ctx, "Filecoin.WalletSign", &sig, addr, []byte("other"), meta).Error(), "do not match")
+
+	var sm wlib.SignedMessage
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletSignMessage", &sm, addr, msg))
+	require.Equal(t, sig.Data, sm.Signature.Data)
+
+	// export needs admin
+	var ki signer.KeyInfo
+	require.Contains(t, c.Call(ctx, "Filecoin.WalletExport", &ki, addr).Error(), "missing permission")
+	require.NoError(t, admin.Call(ctx, "Filecoin.WalletExport", &ki, addr))
+	require.Equal(t, wlib.GenAddress(wlib.SecpPrivateToPublic(base64.StdEncoding.EncodeToString(ki.PrivateKey)), "secp"), addr)
+
+	require.NoError(t, admin.Call(ctx, "Filecoin.WalletDelete", nil, addr))
+	var has bool
+	require.NoError(t, c.Call(ctx, "Filecoin.WalletHas", &has, addr))
+	require.False(t, has)
+
+	var imported string
+	require.NoError(t, admin.Call(ctx, "Filecoin.WalletImport", &imported, &ki))
+	require.Equal(t, addr, imported)
+
+	require.Contains(t, accessLog.String(), "Filecoin.WalletExport perm=sign")
+}
+
+func TestServerImportInvalidKey(t *testing.T) {
+	ks, err := signer.OpenKeystore(t.TempDir(), "secret")
+	require.NoError(t, err)
+	srv := httptest.NewServer(signer.NewServer(ks, map[string]signer.Perm{"admin": signer.PermAdmin}, nil))
+	defer srv.Close()
+
+	ctx := context.Background()
+	admin := wlib.NewClient(srv.URL, "admin")
+	order, _ := hex.DecodeString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	for _, ki := range []signer.KeyInfo{
+		{Type: signer.KTSecp256k1, PrivateKey: make([]byte, 32)},
+		{Type: signer.KTSecp256k1, PrivateKey: make([]byte, 31)},
+		{Type: signer.KTSecp256k1, PrivateKey: order},
+		{Type: signer.KTBLS, PrivateKey: order},
+	} {
+		var imported string
+		err := admin.Call(ctx, "Filecoin.WalletImport", &imported, &ki)
+		var rpcErr *wlib.RPCError
+		require.True(t, xerrors.As(err, &rpcErr), "%v", err)
+		require.Equal(t, -32602, rpcErr.Code)
+	}
+
+	var list []string
+	require.NoError(t, admin.Call(ctx, "Filecoin.WalletList", &list))
+	require.Empty(t, list)
+}
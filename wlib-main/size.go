@@ -0,0 +1,155 @@
+package wlib
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"golang.org/x/xerrors"
+)
+
+// sizeUnits 是 ParseSize 接受的单位（小写），KiB 等为 1024 进制，KB 等为 1000 进制，
+// Ki 等与 DeciStr 的输出相同
+var sizeUnits = func() map[string]*big.Int {
+	m := map[string]*big.Int{"": big.NewInt(1), "b": big.NewInt(1)}
+	for i, p := range []string{"k", "m", "g", "t", "p", "e", "z"} {
+		bin := new(big.Int).Lsh(big.NewInt(1), uint(10*(i+1)))
+		dec := pow10(3 * (i + 1))
+		m[p+"i"], m[p+"ib"] = bin, bin
+		m[p], m[p+"b"] = dec, dec
+	}
+	return m
+}()
+
+// ParseSize 解析字节数，是 SizeStr 和 DeciStr 的逆运算，如 "32 GiB"、"1.5 Ti"、
+// "500 GB"、"2048"。只接受十进制数，可以有小数，但结果必须是整数字节
+func ParseSize(s string) (BigInt, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, unicode.IsLetter)
+	unit := s[len(num):]
+	num = strings.TrimSpace(num)
+
+	mul, ok := sizeUnits[strings.ToLower(unit)]
+	if !ok {
+		return BigInt{}, fmt.Errorf("unrecognized size unit %q", unit)
+	}
+
+	if len(num) > 50 {
+		return BigInt{}, fmt.Errorf("string length too large: %d", len(num))
+	}
+	if !isPlainDecimal(num) {
+		return BigInt{}, fmt.Errorf("invalid size %q", s)
+	}
+	r, ok := new(big.Rat).SetString(num)
+	if !ok {
+		return BigInt{}, fmt.Errorf("invalid size %q", s)
+	}
+
+	r.Mul(r, new(big.Rat).SetInt(mul))
+	if !r.IsInt() {
+		return BigInt{}, fmt.Errorf("size %q is not a whole number of bytes", s)
+	}
+	return BigInt{Int: r.Num()}, nil
+}
+
+// isPlainDecimal 只接受十进制数字和可选的小数部分，big.Rat 还会接受的
+// "0x10"、"0b11"、"1_000"、"1e3"、"1/2" 等写法都不行
+func isPlainDecimal(s string) bool {
+	intPart, frac := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+		if frac == "" {
+			return false
+		}
+	}
+	if intPart == "" {
+		return false
+	}
+	for _, c := range intPart + frac {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseUint64Size(s string) (uint64, error) {
+	b, err := ParseSize(s)
+	if err != nil {
+		return 0, err
+	}
+	if !b.IsUint64() {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return b.Uint64(), nil
+}
+
+var sectorSizes = []abi.SectorSize{2 << 10, 8 << 20, 512 << 20, 32 << 30, 64 << 30}
+
+// ParseSectorSize 解析扇区大小，必须是 2KiB、8MiB、512MiB、32GiB 或 64GiB
+func ParseSectorSize(s string) (abi.SectorSize, error) {
+	n, err := parseUint64Size(s)
+	if err != nil {
+		return 0, err
+	}
+	for _, ss := range sectorSizes {
+		if abi.SectorSize(n) == ss {
+			return ss, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid sector size %q, expect one of 2KiB, 8MiB, 512MiB, 32GiB, 64GiB", s)
+}
+
+// ParsePaddedPieceSize 解析填充后的 piece 大小，必须是不小于 128 字节的 2 的幂
+func ParsePaddedPieceSize(s string) (abi.PaddedPieceSize, error) {
+	n, err := parseUint64Size(s)
+	if err != nil {
+		return 0, err
+	}
+	p := abi.PaddedPieceSize(n)
+	if err := p.Validate(); err != nil {
+		return 0, fmt.Errorf("invalid padded piece size %q: %v", s, err)
+	}
+	return p, nil
+}
+
+// SizeOut 是 ParseSizeStr 的输出
+type SizeOut struct {
+	Err   string `json:"err,omitempty"`
+	Bytes string `json:"bytes,omitempty"`
+	Size  string `json:"size,omitempty"`
+}
+
+// ParseSizeStr 解析用户输入的大小，kind 为空时不检查，"sector" 检查扇区大小，
+// "piece" 检查填充后的 piece 大小
+// 输出 {"bytes": "34359738368", "size": "32 GiB"}
+func ParseSizeStr(s, kind string) string {
+	var b BigInt
+	var err error
+	switch kind {
+	case "":
+		b, err = ParseSize(s)
+	case "sector":
+		var ss abi.SectorSize
+		ss, err = ParseSectorSize(s)
+		b = NewInt(uint64(ss))
+	case "piece":
+		var ps abi.PaddedPieceSize
+		ps, err = ParsePaddedPieceSize(s)
+		b = NewInt(uint64(ps))
+	default:
+		err = xerrors.Errorf("unknown kind %q, expect sector or piece", kind)
+	}
+
+	o := &SizeOut{}
+	if err != nil {
+		o.Err = err.Error()
+	} else {
+		o.Bytes = b.String()
+		o.Size = SizeStr(b)
+	}
+
+	return jsonOut(o)
+}
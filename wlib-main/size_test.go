@@ -0,0 +1,64 @@
+package wlib_test
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]string{
+		"2048":     "2048",
+		"512 B":    "512",
+		"32 GiB":   "34359738368",
+		"32GiB":    "34359738368",
+		"1.5 Ti":   "1649267441664",
+		"0.5 kib":  "512",
+		"500 GB":   "500000000000",
+		"1.5 MB":   "1500000",
+		"100 TiB":  "109951162777600",
+		"2 EiB":    "2305843009213693952",
+		"1.25 KiB": "1280",
+	} {
+		b, err := wlib.ParseSize(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, b.String(), in)
+	}
+
+	for _, in := range []string{"", "-1 GiB", "1.3 B", "1 XB", "1e3 KB", "GiB",
+		"0x10 GiB", "0b11 KB", "0o7 B", "0x1p3", "1_000", "1_000 KiB", "1/2 KiB", "+1 KiB", ".5 KiB", "1. KiB", "1.2.3 KiB"} {
+		_, err := wlib.ParseSize(in)
+		require.Error(t, err, in)
+	}
+
+	// inverse of SizeStr and DeciStr
+	for _, in := range []string{"32 GiB", "1.5 TiB", "64 MiB"} {
+		b, err := wlib.ParseSize(in)
+		require.NoError(t, err)
+		require.Equal(t, in, wlib.SizeStr(b))
+		back, err := wlib.ParseSize(wlib.DeciStr(b))
+		require.NoError(t, err)
+		require.Equal(t, b, back)
+	}
+}
+
+func TestParseSectorAndPieceSize(t *testing.T) {
+	ss, err := wlib.ParseSectorSize("32 GiB")
+	require.NoError(t, err)
+	require.Equal(t, abi.SectorSize(32<<30), ss)
+	_, err = wlib.ParseSectorSize("32 GB")
+	require.Error(t, err)
+
+	ps, err := wlib.ParsePaddedPieceSize("1 MiB")
+	require.NoError(t, err)
+	require.Equal(t, abi.PaddedPieceSize(1<<20), ps)
+	for _, in := range []string{"1 MB", "64 B", "3 KiB", "20 EiB"} {
+		_, err := wlib.ParsePaddedPieceSize(in)
+		require.Error(t, err, in)
+	}
+
+	require.Equal(t, `{"bytes":"68719476736","size":"64 GiB"}`, wlib.ParseSizeStr("64GiB", "sector"))
+	require.Contains(t, wlib.ParseSizeStr("3 KiB", "piece"), "invalid padded piece size")
+}
@@ -0,0 +1,211 @@
+package wlib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+)
+
+// 与 lotus build 参数一致
+const (
+	BlockGasLimit = 10_000_000_000
+
+	onChainMessageComputeBase    = 38863
+	onChainMessageStorageBase    = 36
+	onChainMessageStoragePerByte = 1
+	storageGasMulti              = 1300
+
+	// SignedMessage 比 Message 多出的字节：数组头 1，签名的 byte string 头 2，类型 1 + 65 字节签名
+	secpSignatureOverhead = 1 + 2 + 1 + 65
+)
+
+// ZeroAddress 是 lotus 中的 f3 零地址，nv7 之后不能作为接收方
+var ZeroAddress = func() address.Address {
+	a, err := address.NewBLSAddress(append([]byte{0xc0}, make([]byte, address.BlsPublicKeyBytes-1)...))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// MinGasForSize 链上存储 size 字节消息的最低 gas，即 pricelist.OnChainMessage(size).Total()
+func MinGasForSize(size int) int64 {
+	return onChainMessageComputeBase + (onChainMessageStorageBase+onChainMessageStoragePerByte*int64(size))*storageGasMulti
+}
+
+// ChainLength 消息上链后的字节数，secp / delegated 签名的消息按带签名计算
+func (m *Message) ChainLength() int {
+	b, err := m.Serialize()
+	if err != nil {
+		return 0
+	}
+	if m.From.Protocol() == address.BLS {
+		return len(b)
+	}
+	return len(b) + secpSignatureOverhead
+}
+
+func (m *Message) serializable() bool {
+	return m.To != address.Undef && m.From != address.Undef &&
+		m.Value.Int != nil && m.GasFeeCap.Int != nil && m.GasPremium.Int != nil
+}
+
+// MinGas 消息能被打包的最低 GasLimit
+func (m *Message) MinGas() int64 {
+	return MinGasForSize(m.ChainLength())
+}
+
+// ValidationError 是消息所有不满足 ValidForBlockInclusion 的地方
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return strings.Join(e, "; ")
+}
+
+// Validate 按 lotus 的 ValidForBlockInclusion 检查消息，一次返回全部问题
+func (m *Message) Validate() error {
+	var errs ValidationError
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if m.Version != 0 {
+		add("'Version' unsupported")
+	}
+
+	if m.To == address.Undef {
+		add("'To' address cannot be empty")
+	} else if m.To == ZeroAddress {
+		add("invalid 'To' address")
+	}
+
+	if m.From == address.Undef {
+		add("'From' address cannot be empty")
+	}
+
+	if m.Value.Int == nil {
+		add("'Value' cannot be nil")
+	} else if m.Value.LessThan(big.Zero()) {
+		add("'Value' field cannot be negative")
+	} else if m.Value.GreaterThan(TotalFilecoinInt) {
+		add("'Value' field cannot be greater than total filecoin supply")
+	}
+
+	if m.GasFeeCap.Int == nil {
+		add("'GasFeeCap' cannot be nil")
+	} else if m.GasFeeCap.LessThan(big.Zero()) {
+		add("'GasFeeCap' field cannot be negative")
+	}
+
+	if m.GasPremium.Int == nil {
+		add("'GasPremium' cannot be nil")
+	} else if m.GasPremium.LessThan(big.Zero()) {
+		add("'GasPremium' field cannot be negative")
+	} else if m.GasFeeCap.Int != nil && m.GasPremium.GreaterThan(m.GasFeeCap) {
+		add("'GasFeeCap' less than 'GasPremium'")
+	}
+
+	if m.GasLimit > BlockGasLimit {
+		add("'GasLimit' field cannot be greater than a block's gas limit")
+	}
+	if m.GasLimit <= 0 {
+		add("'GasLimit' field %d must be positive", m.GasLimit)
+	} else if m.serializable() {
+		if minGas := m.MinGas(); m.GasLimit < minGas {
+			add("'GasLimit' field cannot be less than the cost of storing a message on chain %d < %d", m.GasLimit, minGas)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+type ValidateOut struct {
+	Err        string   `json:"err,omitempty"`
+	Valid      bool     `json:"valid"`
+	MinGas     int64    `json:"min_gas,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+func validateOut(o *ValidateOut, err error) string {
+	if err != nil {
+		o = &ValidateOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+// lenientMessage 与 toMessage 相同，但空字段保留为零值，交给 Validate 报告
+func (msg *Msg) lenientMessage() (*Message, ValidationError) {
+	var errs ValidationError
+	m := &Message{
+		Version:  msg.Version,
+		Nonce:    msg.Nonce,
+		GasLimit: msg.GasLimit,
+		Method:   abi.MethodNum(msg.Method),
+	}
+
+	parseAddr := func(name, s string) address.Address {
+		if s == "" {
+			return address.Undef
+		}
+		a, err := address.NewFromString(s)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid '%s' address(%s): %v", name, s, err))
+		}
+		return a
+	}
+	parseBig := func(name, s string) BigInt {
+		if s == "" {
+			return EmptyInt
+		}
+		v, err := big.FromString(s)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("invalid '%s'(%s): %v", name, s, err))
+			return NewInt(0)
+		}
+		return v
+	}
+
+	m.To = parseAddr("To", msg.To)
+	m.From = parseAddr("From", msg.From)
+	m.Value = parseBig("Value", msg.Value)
+	m.GasFeeCap = parseBig("GasFeeCap", msg.GasFeeCap)
+	m.GasPremium = parseBig("GasPremium", msg.GasPremium)
+
+	params, err := base64.StdEncoding.DecodeString(msg.Params)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("invalid 'Params': %v", err))
+	}
+	m.Params = params
+
+	return m, errs
+}
+
+// ValidateMessage 签名前检查 Msg json 能否被网络接受
+// 输出 {"valid": false, "min_gas": 130000, "violations": ["'GasFeeCap' less than 'GasPremium'", ...]}
+func ValidateMessage(jsonstr string) string {
+	var msg Msg
+	if err := json.Unmarshal([]byte(jsonstr), &msg); err != nil {
+		return validateOut(nil, fmt.Errorf("invalid message json: %v", err))
+	}
+
+	m, violations := msg.lenientMessage()
+	if err := m.Validate(); err != nil {
+		violations = append(violations, err.(ValidationError)...)
+	}
+
+	o := &ValidateOut{Valid: len(violations) == 0, Violations: violations}
+	if m.serializable() {
+		o.MinGas = m.MinGas()
+	}
+
+	return validateOut(o, nil)
+}
@@ -0,0 +1,35 @@
+package wlib_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestValidateMessage(t *testing.T) {
+	var o wlib.ValidateOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.ValidateMessage(feeMsg)), &o))
+	require.Equal(t, "", o.Err)
+	require.True(t, o.Valid)
+	require.Greater(t, o.MinGas, int64(100000))
+
+	o = wlib.ValidateOut{}
+	require.NoError(t, json.Unmarshal([]byte(wlib.ValidateMessage(`{"version": 1, "to": "", "from": "t01001",
+		"value": "-1", "gaslimit": 0, "gasfeecap": "100", "gaspremium": "200", "params": ""}`)), &o))
+	require.False(t, o.Valid)
+	require.Equal(t, []string{
+		"'Version' unsupported",
+		"'To' address cannot be empty",
+		"'Value' field cannot be negative",
+		"'GasFeeCap' less than 'GasPremium'",
+		"'GasLimit' field 0 must be positive",
+	}, o.Violations)
+
+	o = wlib.ValidateOut{}
+	require.NoError(t, json.Unmarshal([]byte(wlib.ValidateMessage(`{"to": "t01000", "from": "t01001",
+		"value": "0", "gaslimit": 1000, "gasfeecap": "100", "gaspremium": "100", "params": ""}`)), &o))
+	require.Len(t, o.Violations, 1)
+	require.Contains(t, o.Violations[0], "cost of storing a message on chain")
+}
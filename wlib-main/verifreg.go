@@ -0,0 +1,333 @@
+package wlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// MethodsVerifreg are the method numbers of the verified registry (f06)
+// since actors v9. The *Exported variants are the FRC-42 numbers.
+var MethodsVerifreg = struct {
+	Constructor                      abi.MethodNum
+	AddVerifier                      abi.MethodNum
+	RemoveVerifier                   abi.MethodNum
+	AddVerifiedClient                abi.MethodNum
+	RemoveVerifiedClientDataCap      abi.MethodNum
+	RemoveExpiredAllocations         abi.MethodNum
+	GetClaims                        abi.MethodNum
+	ExtendClaimTerms                 abi.MethodNum
+	RemoveExpiredClaims              abi.MethodNum
+	AddVerifiedClientExported        abi.MethodNum
+	RemoveExpiredAllocationsExported abi.MethodNum
+	GetClaimsExported                abi.MethodNum
+	ExtendClaimTermsExported         abi.MethodNum
+	RemoveExpiredClaimsExported      abi.MethodNum
+	UniversalReceiverHook            abi.MethodNum
+}{1, 2, 3, 4, 7, 8, 9, 10, 11, 3916220144, 2421068268, 2199871187, 1752273514, 2873373899, 3726118371}
+
+const VerifiedRegistryActorID = 6
+
+type ClaimTerm struct {
+	Provider abi.ActorID
+	ClaimID  uint64
+	TermMax  abi.ChainEpoch
+}
+
+type ExtendClaimTermsParams struct {
+	Terms []ClaimTerm
+}
+
+type RemoveExpiredAllocationsParams struct {
+	Client        abi.ActorID
+	AllocationIDs []uint64
+}
+
+func (t *ExtendClaimTermsParams) MarshalCBOR(w io.Writer) error {
+	if err := cborWriteArrayHeader(w, 1); err != nil {
+		return err
+	}
+	if err := cborWriteArrayHeader(w, len(t.Terms)); err != nil {
+		return err
+	}
+	for _, term := range t.Terms {
+		if err := cborWriteArrayHeader(w, 3); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, uint64(term.Provider)); err != nil {
+			return err
+		}
+		if err := cborWriteUint(w, term.ClaimID); err != nil {
+			return err
+		}
+		if err := cborWriteInt(w, int64(term.TermMax)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *RemoveExpiredAllocationsParams) MarshalCBOR(w io.Writer) error {
+	if err := cborWriteArrayHeader(w, 2); err != nil {
+		return err
+	}
+	if err := cborWriteUint(w, uint64(t.Client)); err != nil {
+		return err
+	}
+	if err := cborWriteArrayHeader(w, len(t.AllocationIDs)); err != nil {
+		return err
+	}
+	for _, id := range t.AllocationIDs {
+		if err := cborWriteUint(w, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseActorID(s string) (abi.ActorID, error) {
+	a, err := address.NewFromString(s)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := address.IDFromAddress(a)
+	if err != nil {
+		return 0, xerrors.Errorf("%s is not an ID address", s)
+	}
+
+	return abi.ActorID(id), nil
+}
+
+type ClaimTermInput struct {
+	Provider string `json:"provider"`
+	ClaimID  uint64 `json:"claim_id"`
+	TermMax  int64  `json:"term_max"`
+}
+
+// GenExtendClaimTermsParam 延长 claim 的最大期限，发送到 f06
+// 方法 MethodsVerifreg.ExtendClaimTerms
+// 传入 json [{"provider": "f01234", "claim_id": 1, "term_max": 5256000}]
+func GenExtendClaimTermsParam(input string) string {
+	var terms []ClaimTermInput
+	if err := json.Unmarshal([]byte(input), &terms); err != nil {
+		return genOut(nil, xerrors.Errorf("invalid input json: %s, %v", input, err))
+	}
+
+	params := &ExtendClaimTermsParams{}
+	for _, t := range terms {
+		provider, err := parseActorID(t.Provider)
+		if err != nil {
+			return genOut(nil, xerrors.Errorf("invalid provider(%s): %v", t.Provider, err))
+		}
+		params.Terms = append(params.Terms, ClaimTerm{
+			Provider: provider,
+			ClaimID:  t.ClaimID,
+			TermMax:  abi.ChainEpoch(t.TermMax),
+		})
+	}
+
+	enc, err := SerializeParams(params)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize ExtendClaimTermsParams: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+// GenRemoveExpiredAllocationsParam 回收过期 allocation 的 DataCap，发送到 f06
+// 方法 MethodsVerifreg.RemoveExpiredAllocations
+// client 为 ID 地址，ids 为 json 数组，空数组表示全部过期的 allocation
+func GenRemoveExpiredAllocationsParam(client, ids string) string {
+	c, err := parseActorID(client)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("invalid client(%s): %v", client, err))
+	}
+
+	params := &RemoveExpiredAllocationsParams{Client: c, AllocationIDs: []uint64{}}
+	if ids != "" {
+		if err := json.Unmarshal([]byte(ids), &params.AllocationIDs); err != nil {
+			return genOut(nil, xerrors.Errorf("invalid allocation ids: %s, %v", ids, err))
+		}
+	}
+
+	enc, err := SerializeParams(params)
+	if err != nil {
+		return genOut(nil, xerrors.Errorf("failed to serialize RemoveExpiredAllocationsParams: %v", err))
+	}
+
+	return genOut(enc, nil)
+}
+
+// parseAllowance 解析 DataCap 额度，单位同 ParseSize：KiB、TiB 等为 1024 进制，
+// KB、TB 等为 1000 进制，没有单位时为字节
+func parseAllowance(allowance string) (abi.StoragePower, error) {
+	a, err := ParseSize(allowance)
+	if err != nil {
+		return EmptyInt, err
+	}
+	if a.Sign() <= 0 {
+		return EmptyInt, xerrors.Errorf("allowance must be positive")
+	}
+	return a, nil
+}
+
+func genVerifregParam(method abi.MethodNum, addr, allowance string) ([]byte, error) {
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid address(%s): %v", addr, err)
+	}
+
+	var params cbg.CBORMarshaler
+	switch method {
+	case MethodsVerifreg.RemoveVerifier:
+		params = &a
+	default:
+		dc, err := parseAllowance(allowance)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid allowance(%s): %v", allowance, err)
+		}
+		if method == MethodsVerifreg.AddVerifier {
+			params = &AddVerifierParams{Address: a, Allowance: dc}
+		} else {
+			params = &AddVerifiedClientParams{Address: a, Allowance: dc}
+		}
+	}
+
+	return SerializeParams(params)
+}
+
+func genVerifregProposal(method abi.MethodNum, addr, allowance string) ([]byte, error) {
+	enc, err := genVerifregParam(method, addr, allowance)
+	if err != nil {
+		return nil, err
+	}
+
+	verifreg, _ := address.NewIDAddress(VerifiedRegistryActorID)
+	return SerializeParams(&ProposeParams{
+		To:     verifreg,
+		Value:  abi.NewTokenAmount(0),
+		Method: method,
+		Params: enc,
+	})
+}
+
+// GenAddVerifierParam 根密钥持有人添加公证人，发送到 f06，方法 MethodsVerifreg.AddVerifier
+// allowance 可以是 "100 TiB" 这样的大小，也可以是字节数
+func GenAddVerifierParam(verifier, allowance string) string {
+	return genOut(genVerifregParam(MethodsVerifreg.AddVerifier, verifier, allowance))
+}
+
+// GenRemoveVerifierParam 移除公证人，发送到 f06，方法 MethodsVerifreg.RemoveVerifier
+func GenRemoveVerifierParam(verifier string) string {
+	return genOut(genVerifregParam(MethodsVerifreg.RemoveVerifier, verifier, ""))
+}
+
+// GenAddVerifiedClientParam 公证人为客户分配 DataCap，发送到 f06，方法 MethodsVerifreg.AddVerifiedClient
+func GenAddVerifiedClientParam(client, allowance string) string {
+	return genOut(genVerifregParam(MethodsVerifreg.AddVerifiedClient, client, allowance))
+}
+
+// GenProposalForAddVerifier 根密钥多签（f080）提案添加公证人
+func GenProposalForAddVerifier(verifier, allowance string) string {
+	return genOut(genVerifregProposal(MethodsVerifreg.AddVerifier, verifier, allowance))
+}
+
+// GenProposalForRemoveVerifier 根密钥多签（f080）提案移除公证人
+func GenProposalForRemoveVerifier(verifier string) string {
+	return genOut(genVerifregProposal(MethodsVerifreg.RemoveVerifier, verifier, ""))
+}
+
+// GenProposalForAddVerifiedClient 公证人多签提案为客户分配 DataCap
+func GenProposalForAddVerifiedClient(client, allowance string) string {
+	return genOut(genVerifregProposal(MethodsVerifreg.AddVerifiedClient, client, allowance))
+}
+
+// ProposalOut 是 DescribeProposal 的输出
+type ProposalOut struct {
+	Err string `json:"err,omitempty"`
+	To  string `json:"to,omitempty"`
+	// Value 单位 attoFIL
+	Value      string `json:"value,omitempty"`
+	Method     uint64 `json:"method"`
+	MethodName string `json:"method_name,omitempty"`
+	Params     []byte `json:"params,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Allowance  string `json:"allowance,omitempty"`
+	Size       string `json:"size,omitempty"`
+}
+
+func proposalOut(o *ProposalOut, err error) string {
+	if err != nil {
+		o = &ProposalOut{Err: err.Error()}
+	}
+
+	return jsonOut(o)
+}
+
+func describeVerifreg(o *ProposalOut, params []byte) error {
+	switch abi.MethodNum(o.Method) {
+	case MethodsVerifreg.AddVerifier:
+		o.MethodName = "AddVerifier"
+		var p AddVerifierParams
+		if err := p.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+			return xerrors.Errorf("failed to decode AddVerifierParams: %v", err)
+		}
+		o.Address, o.Allowance, o.Size = p.Address.String(), p.Allowance.String(), SizeStr(p.Allowance)
+	case MethodsVerifreg.RemoveVerifier:
+		o.MethodName = "RemoveVerifier"
+		var a address.Address
+		if err := a.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+			return xerrors.Errorf("failed to decode verifier address: %v", err)
+		}
+		o.Address = a.String()
+	case MethodsVerifreg.AddVerifiedClient, MethodsVerifreg.AddVerifiedClientExported:
+		o.MethodName = "AddVerifiedClient"
+		var p AddVerifiedClientParams
+		if err := p.UnmarshalCBOR(bytes.NewReader(params)); err != nil {
+			return xerrors.Errorf("failed to decode AddVerifiedClientParams: %v", err)
+		}
+		o.Address, o.Allowance, o.Size = p.Address.String(), p.Allowance.String(), SizeStr(p.Allowance)
+	}
+	return nil
+}
+
+// DescribeProposal 解码多签 Propose 的参数（base64），供签名前审核
+// 发往 f06 的公证人相关提案会解出地址与额度
+// 输出 {"to": "f06", "value": "0", "method": 4, "method_name": "AddVerifiedClient",
+// "address": "f1...", "allowance": "109951162777600", "size": "100 TiB"}
+func DescribeProposal(params string) string {
+	b, err := base64.StdEncoding.DecodeString(params)
+	if err != nil {
+		return proposalOut(nil, xerrors.Errorf("invalid params: %v", err))
+	}
+
+	var p ProposeParams
+	if err := p.UnmarshalCBOR(bytes.NewReader(b)); err != nil {
+		return proposalOut(nil, xerrors.Errorf("failed to decode ProposeParams: %v", err))
+	}
+
+	o := &ProposalOut{
+		To:     p.To.String(),
+		Value:  p.Value.String(),
+		Method: uint64(p.Method),
+		Params: p.Params,
+	}
+	if p.Method == 0 {
+		o.MethodName = "Send"
+	}
+
+	if id, err := address.IDFromAddress(p.To); err == nil && id == VerifiedRegistryActorID {
+		if err := describeVerifreg(o, p.Params); err != nil {
+			return proposalOut(nil, err)
+		}
+	}
+
+	return proposalOut(o, nil)
+}
@@ -0,0 +1,50 @@
+package wlib_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.forceup.in/FilecoinWallet/FilWallet/wlib"
+)
+
+func TestGenProposalForAddVerifiedClient(t *testing.T) {
+	o := parseOut(t, wlib.GenProposalForAddVerifiedClient("f01234", "100 TiB"))
+	require.Equal(t, "", o.Err)
+
+	var p wlib.ProposalOut
+	require.NoError(t, json.Unmarshal([]byte(wlib.DescribeProposal(base64.StdEncoding.EncodeToString(o.Param))), &p))
+	require.Equal(t, "", p.Err)
+	require.Equal(t, "06", p.To[1:])
+	require.Equal(t, "0", p.Value)
+	require.Equal(t, "AddVerifiedClient", p.MethodName)
+	require.Equal(t, "01234", p.Address[1:])
+	require.Equal(t, "109951162777600", p.Allowance)
+	require.Equal(t, "100 TiB", p.Size)
+
+	o = parseOut(t, wlib.GenProposalForRemoveVerifier("f01234"))
+	require.Equal(t, "", o.Err)
+	require.NoError(t, json.Unmarshal([]byte(wlib.DescribeProposal(base64.StdEncoding.EncodeToString(o.Param))), &p))
+	require.Equal(t, "RemoveVerifier", p.MethodName)
+	require.Equal(t, "01234", p.Address[1:])
+
+	f410 := wlib.EthAddressToFil("0xd4c5fb16488aa48081296299d54b0c648c9333da")
+	o = parseOut(t, wlib.GenProposalForAddVerifiedClient(f410, "1 TiB"))
+	require.Equal(t, "", o.Err)
+	require.NoError(t, json.Unmarshal([]byte(wlib.DescribeProposal(base64.StdEncoding.EncodeToString(o.Param))), &p))
+	require.Equal(t, f410, p.Address)
+
+	// decimal and binary units are not interchangeable
+	for allowance, bytes := range map[string]string{"1 KB": "1000", "1 KiB": "1024", "2 TB": "2000000000000", "2048": "2048"} {
+		o = parseOut(t, wlib.GenProposalForAddVerifiedClient("f01234", allowance))
+		require.Equal(t, "", o.Err)
+		require.NoError(t, json.Unmarshal([]byte(wlib.DescribeProposal(base64.StdEncoding.EncodeToString(o.Param))), &p))
+		require.Equal(t, bytes, p.Allowance, allowance)
+	}
+
+	o = parseOut(t, wlib.GenAddVerifierParam("f01234", "1.5 XB"))
+	require.Contains(t, o.Err, "invalid allowance")
+	o = parseOut(t, wlib.GenAddVerifierParam("f01234", "0"))
+	require.Contains(t, o.Err, "positive")
+}
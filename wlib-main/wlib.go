@@ -9,6 +9,7 @@ import (
 	crypto "github.com/filecoin-project/go-crypto"
 	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/filecoin-project/go-state-types/big"
+	crypto2 "github.com/filecoin-project/go-state-types/crypto"
 	"github.com/minio/blake2b-simd"
 )
 
@@ -25,6 +26,70 @@ type Msg struct {
 	Params     string `json:"params"`
 }
 
+// toMessage converts the json message into a Message, see MessageCid.
+func (msg *Msg) toMessage() (*Message, error) {
+	toAddr, err := address.NewFromString(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to address(%s): %v", msg.To, err)
+	}
+	fromAddr, err := address.NewFromString(msg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address(%s): %v", msg.From, err)
+	}
+	v, err := big.FromString(msg.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value(%s): %v", msg.Value, err)
+	}
+	gasfeecap, err := big.FromString(msg.GasFeeCap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gasfeecap(%s): %v", msg.GasFeeCap, err)
+	}
+	gaspremium, err := big.FromString(msg.GasPremium)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gaspremium(%s): %v", msg.GasPremium, err)
+	}
+	pbytes, err := base64.StdEncoding.DecodeString(msg.Params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+
+	return &Message{
+		Version:    msg.Version,
+		To:         toAddr,
+		From:       fromAddr,
+		Nonce:      msg.Nonce,
+		Value:      v,
+		GasLimit:   msg.GasLimit,
+		GasFeeCap:  abi.TokenAmount(gasfeecap),
+		GasPremium: abi.TokenAmount(gaspremium),
+		Method:     abi.MethodNum(msg.Method),
+		Params:     pbytes,
+	}, nil
+}
+
+func parseMsg(jsonstr string) (*Message, error) {
+	var msg Msg
+	if err := json.Unmarshal([]byte(jsonstr), &msg); err != nil {
+		return nil, fmt.Errorf("invalid message json: %v", err)
+	}
+	return msg.toMessage()
+}
+
+func newMsg(m *Message) *Msg {
+	return &Msg{
+		Version:    m.Version,
+		To:         m.To.String(),
+		From:       m.From.String(),
+		Nonce:      m.Nonce,
+		Value:      m.Value.String(),
+		GasLimit:   m.GasLimit,
+		GasFeeCap:  m.GasFeeCap.String(),
+		GasPremium: m.GasPremium.String(),
+		Method:     uint64(m.Method),
+		Params:     base64.StdEncoding.EncodeToString(m.Params),
+	}
+}
+
 func GenAddress(pk, t string) string {
 	if pk == "" {
 		return ""
@@ -174,6 +239,43 @@ func SecpSign(ck string, msg string) string {
 	return base64.StdEncoding.EncodeToString(sig)
 }
 
+// secpSign signs the blake2b-256 digest of data, the same way SecpSign does.
+func secpSign(ck, data []byte) (*crypto2.Signature, error) {
+	b2sum := blake2b.Sum256(data)
+	sig, err := crypto.Sign(ck, b2sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &crypto2.Signature{Type: crypto2.SigTypeSecp256k1, Data: sig}, nil
+}
+
+// secpVerify checks that sig over data was produced by the key behind signer.
+func secpVerify(signer address.Address, data []byte, sig *crypto2.Signature) error {
+	if sig == nil {
+		return fmt.Errorf("missing signature")
+	}
+	if sig.Type != crypto2.SigTypeSecp256k1 || signer.Protocol() != address.SECP256K1 {
+		return fmt.Errorf("only secp256k1 signatures are supported, got type %d for %s", sig.Type, signer)
+	}
+
+	b2sum := blake2b.Sum256(data)
+	pk, err := crypto.EcRecover(b2sum[:], sig.Data)
+	if err != nil {
+		return err
+	}
+
+	recovered, err := address.NewSecp256k1Address(pk)
+	if err != nil {
+		return err
+	}
+	if recovered != signer {
+		return fmt.Errorf("signature was made by %s, not %s", recovered, signer)
+	}
+
+	return nil
+}
+
 func checkError(e error) {
 	if e != nil {
 		panic(e)